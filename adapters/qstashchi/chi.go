@@ -0,0 +1,14 @@
+// Package qstashchi verifies the signature of the requests delivered by QStash to a chi router.
+package qstashchi
+
+import (
+	"net/http"
+
+	"github.com/upstash/qstash-go"
+)
+
+// Verify returns a chi middleware that rejects the requests with an invalid signature with 401 Unauthorized.
+// The body of the verified requests can be read again by the handlers.
+func Verify(receiver *qstash.Receiver, opts qstash.VerifyRequestOptions) func(http.Handler) http.Handler {
+	return receiver.Middleware(opts)
+}
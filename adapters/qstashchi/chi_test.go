@@ -0,0 +1,36 @@
+package qstashchi
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/upstash/qstash-go"
+	"github.com/upstash/qstash-go/internal/signtest"
+)
+
+func TestVerify(t *testing.T) {
+	r := chi.NewRouter()
+	r.Use(Verify(qstash.NewReceiver(signtest.Key, signtest.Key), qstash.VerifyRequestOptions{BaseUrl: "https://example.com"}))
+	r.Post("/orders", func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		_, _ = w.Write(body)
+	})
+
+	for url, status := range map[string]int{"https://example.com/orders": http.StatusOK, "https://example.com/other": http.StatusUnauthorized} {
+		signature, err := signtest.Sign(url, "body")
+		assert.NoError(t, err)
+		req := httptest.NewRequest(http.MethodPost, "/orders", strings.NewReader("body"))
+		req.Header.Set("Upstash-Signature", signature)
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		assert.Equal(t, status, w.Code, url)
+		if status == http.StatusOK {
+			assert.Equal(t, "body", w.Body.String())
+		}
+	}
+}
@@ -0,0 +1,22 @@
+// Package qstashecho verifies the signature of the requests delivered by QStash to an echo server.
+package qstashecho
+
+import (
+	"net/http"
+
+	"github.com/labstack/echo/v4"
+	"github.com/upstash/qstash-go"
+)
+
+// Verify returns an echo middleware that rejects the requests with an invalid signature with 401 Unauthorized.
+// The body of the verified requests can be bound again by the handlers.
+func Verify(receiver *qstash.Receiver, opts qstash.VerifyRequestOptions) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			if _, err := receiver.VerifyHTTPRequest(c.Request(), opts); err != nil {
+				return echo.NewHTTPError(http.StatusUnauthorized, err.Error())
+			}
+			return next(c)
+		}
+	}
+}
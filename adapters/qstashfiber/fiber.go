@@ -0,0 +1,17 @@
+// Package qstashfiber verifies the signature of the requests delivered by QStash to a fiber app.
+package qstashfiber
+
+import (
+	"github.com/gofiber/fiber/v2"
+	"github.com/upstash/qstash-go"
+)
+
+// Verify returns a fiber middleware that rejects the requests with an invalid signature with 401 Unauthorized.
+func Verify(receiver *qstash.Receiver, opts qstash.VerifyRequestOptions) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		if err := receiver.VerifyRequest(c.Get("Upstash-Signature"), c.Body(), c.OriginalURL(), opts); err != nil {
+			return fiber.NewError(fiber.StatusUnauthorized, err.Error())
+		}
+		return c.Next()
+	}
+}
@@ -0,0 +1,36 @@
+package qstashfiber
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/upstash/qstash-go"
+	"github.com/upstash/qstash-go/internal/signtest"
+)
+
+func TestVerify(t *testing.T) {
+	app := fiber.New()
+	app.Use(Verify(qstash.NewReceiver(signtest.Key, signtest.Key), qstash.VerifyRequestOptions{BaseUrl: "https://example.com"}))
+	app.Post("/orders", func(c *fiber.Ctx) error {
+		return c.Send(c.Body())
+	})
+
+	for url, status := range map[string]int{"https://example.com/orders?id=1": http.StatusOK, "https://example.com/orders": http.StatusUnauthorized} {
+		signature, err := signtest.Sign(url, "body")
+		assert.NoError(t, err)
+		req := httptest.NewRequest(http.MethodPost, "/orders?id=1", strings.NewReader("body"))
+		req.Header.Set("Upstash-Signature", signature)
+		res, err := app.Test(req)
+		assert.NoError(t, err)
+		assert.Equal(t, status, res.StatusCode, url)
+		if status == http.StatusOK {
+			body, _ := io.ReadAll(res.Body)
+			assert.Equal(t, "body", string(body))
+		}
+	}
+}
@@ -0,0 +1,21 @@
+// Package qstashgin verifies the signature of the requests delivered by QStash to a gin engine.
+package qstashgin
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/upstash/qstash-go"
+)
+
+// Verify returns a gin middleware that aborts the requests with an invalid signature with 401 Unauthorized.
+// The body of the verified requests can be bound again by the handlers.
+func Verify(receiver *qstash.Receiver, opts qstash.VerifyRequestOptions) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if _, err := receiver.VerifyHTTPRequest(c.Request, opts); err != nil {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+			return
+		}
+		c.Next()
+	}
+}
@@ -0,0 +1,49 @@
+package qstashgin
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/upstash/qstash-go"
+	"github.com/upstash/qstash-go/internal/signtest"
+)
+
+func TestVerify(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	engine := gin.New()
+	engine.Use(Verify(qstash.NewReceiver(signtest.Key, signtest.Key), qstash.VerifyRequestOptions{}))
+	engine.POST("/orders", func(c *gin.Context) {
+		var order struct {
+			Id string `json:"id"`
+		}
+		if err := c.ShouldBindJSON(&order); err != nil {
+			c.Status(http.StatusBadRequest)
+			return
+		}
+		c.String(http.StatusOK, order.Id)
+	})
+
+	send := func(signature string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/orders", strings.NewReader(`{"id":"1"}`))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("Upstash-Signature", signature)
+		w := httptest.NewRecorder()
+		engine.ServeHTTP(w, req)
+		return w
+	}
+
+	signature, err := signtest.Sign("https://example.com/orders", `{"id":"1"}`)
+	assert.NoError(t, err)
+	w := send(signature)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "1", w.Body.String())
+
+	signature, err = signtest.Sign("https://example.com/orders", `{"id":"2"}`)
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusUnauthorized, send(signature).Code)
+	assert.Equal(t, http.StatusUnauthorized, send("").Code)
+}
@@ -0,0 +1,16 @@
+module github.com/upstash/qstash-go/adapters/qstashlambda
+
+go 1.22.2
+
+require (
+	github.com/aws/aws-lambda-go v1.47.0
+	github.com/stretchr/testify v1.9.0
+	github.com/upstash/qstash-go v1.0.0
+)
+
+require (
+	github.com/davecgh/go-spew v1.1.1 // indirect
+	github.com/golang-jwt/jwt/v5 v5.2.1 // indirect
+	github.com/pmezard/go-difflib v1.0.0 // indirect
+	gopkg.in/yaml.v3 v3.0.1 // indirect
+)
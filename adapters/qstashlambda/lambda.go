@@ -0,0 +1,139 @@
+// Package qstashlambda verifies the signature of the requests delivered by QStash to AWS Lambda functions,
+// behind an API Gateway or a Lambda Function URL.
+//
+// When VerifyRequestOptions.BaseUrl is set, the url of the request must match the destination the message was published to.
+// Function URLs and HTTP APIs pass the raw path and query of the request, so any destination matches.
+// REST APIs only pass the query as a map, see VerifyAPIGatewayProxyRequest for the destinations they support.
+package qstashlambda
+
+import (
+	"context"
+	"encoding/base64"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/upstash/qstash-go"
+)
+
+// VerifyAPIGatewayProxyRequest verifies the signature of a REST API proxy request, and returns its decoded body.
+//
+// REST APIs do not pass the raw query of the request, so it is rebuilt with its keys sorted and its values escaped as by url.Values.Encode.
+// When BaseUrl is set, a destination with a query only verifies if it was published in that form, such as `?a=2&b=1` rather than `?b=1&a=2`.
+// The path includes the stage, such as `/prod/orders`, when the API is called through its default execute-api endpoint,
+// so BaseUrl is then the url of the API without the stage, such as `https://abc123.execute-api.us-east-1.amazonaws.com`.
+// HTTP APIs and Function URLs pass the raw query, prefer them for destinations with unsorted queries.
+func VerifyAPIGatewayProxyRequest(receiver *qstash.Receiver, req events.APIGatewayProxyRequest, opts qstash.VerifyRequestOptions) ([]byte, error) {
+	body, err := decodeBody(req.Body, req.IsBase64Encoded)
+	if err != nil {
+		return nil, err
+	}
+	query := url.Values{}
+	for k, v := range req.MultiValueQueryStringParameters {
+		query[k] = v
+	}
+	if len(query) == 0 {
+		for k, v := range req.QueryStringParameters {
+			query.Set(k, v)
+		}
+	}
+	// The path of the request context is the path of the public url, including the stage, unlike the path of the resource.
+	uri := req.RequestContext.Path
+	if uri == "" {
+		uri = req.Path
+	}
+	if len(query) > 0 {
+		uri += "?" + query.Encode()
+	}
+	return body, receiver.VerifyRequest(header(req.Headers, "Upstash-Signature"), body, uri, opts)
+}
+
+// VerifyAPIGatewayV2HTTPRequest verifies the signature of an HTTP API request, and returns its decoded body.
+// The raw path includes the stage for stages other than `$default`.
+func VerifyAPIGatewayV2HTTPRequest(receiver *qstash.Receiver, req events.APIGatewayV2HTTPRequest, opts qstash.VerifyRequestOptions) ([]byte, error) {
+	body, err := decodeBody(req.Body, req.IsBase64Encoded)
+	if err != nil {
+		return nil, err
+	}
+	uri := req.RawPath
+	if req.RawQueryString != "" {
+		uri += "?" + req.RawQueryString
+	}
+	return body, receiver.VerifyRequest(header(req.Headers, "Upstash-Signature"), body, uri, opts)
+}
+
+// VerifyFunctionURLRequest verifies the signature of a Lambda Function URL request, and returns its decoded body.
+func VerifyFunctionURLRequest(receiver *qstash.Receiver, req events.LambdaFunctionURLRequest, opts qstash.VerifyRequestOptions) ([]byte, error) {
+	body, err := decodeBody(req.Body, req.IsBase64Encoded)
+	if err != nil {
+		return nil, err
+	}
+	uri := req.RawPath
+	if req.RawQueryString != "" {
+		uri += "?" + req.RawQueryString
+	}
+	return body, receiver.VerifyRequest(header(req.Headers, "Upstash-Signature"), body, uri, opts)
+}
+
+// APIGatewayProxyHandler wraps a Lambda handler, responding to the requests with an invalid signature with 401 Unauthorized.
+func APIGatewayProxyHandler(
+	receiver *qstash.Receiver,
+	opts qstash.VerifyRequestOptions,
+	handler func(ctx context.Context, req events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error),
+) func(ctx context.Context, req events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
+	return func(ctx context.Context, req events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
+		if _, err := VerifyAPIGatewayProxyRequest(receiver, req, opts); err != nil {
+			return events.APIGatewayProxyResponse{StatusCode: http.StatusUnauthorized, Body: err.Error()}, nil
+		}
+		return handler(ctx, req)
+	}
+}
+
+// APIGatewayV2HTTPHandler wraps a Lambda handler, responding to the requests with an invalid signature with 401 Unauthorized.
+func APIGatewayV2HTTPHandler(
+	receiver *qstash.Receiver,
+	opts qstash.VerifyRequestOptions,
+	handler func(ctx context.Context, req events.APIGatewayV2HTTPRequest) (events.APIGatewayV2HTTPResponse, error),
+) func(ctx context.Context, req events.APIGatewayV2HTTPRequest) (events.APIGatewayV2HTTPResponse, error) {
+	return func(ctx context.Context, req events.APIGatewayV2HTTPRequest) (events.APIGatewayV2HTTPResponse, error) {
+		if _, err := VerifyAPIGatewayV2HTTPRequest(receiver, req, opts); err != nil {
+			return events.APIGatewayV2HTTPResponse{StatusCode: http.StatusUnauthorized, Body: err.Error()}, nil
+		}
+		return handler(ctx, req)
+	}
+}
+
+// FunctionURLHandler wraps a Lambda handler, responding to the requests with an invalid signature with 401 Unauthorized.
+func FunctionURLHandler(
+	receiver *qstash.Receiver,
+	opts qstash.VerifyRequestOptions,
+	handler func(ctx context.Context, req events.LambdaFunctionURLRequest) (events.LambdaFunctionURLResponse, error),
+) func(ctx context.Context, req events.LambdaFunctionURLRequest) (events.LambdaFunctionURLResponse, error) {
+	return func(ctx context.Context, req events.LambdaFunctionURLRequest) (events.LambdaFunctionURLResponse, error) {
+		if _, err := VerifyFunctionURLRequest(receiver, req, opts); err != nil {
+			return events.LambdaFunctionURLResponse{StatusCode: http.StatusUnauthorized, Body: err.Error()}, nil
+		}
+		return handler(ctx, req)
+	}
+}
+
+func decodeBody(body string, isBase64Encoded bool) ([]byte, error) {
+	if isBase64Encoded {
+		return base64.StdEncoding.DecodeString(body)
+	}
+	return []byte(body), nil
+}
+
+// header returns the value of a header, whose name is lowercased by Function URLs and API Gateway v2.
+func header(headers map[string]string, name string) string {
+	if v, ok := headers[name]; ok {
+		return v
+	}
+	for k, v := range headers {
+		if strings.EqualFold(k, name) {
+			return v
+		}
+	}
+	return ""
+}
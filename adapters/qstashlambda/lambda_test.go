@@ -0,0 +1,108 @@
+package qstashlambda
+
+import (
+	"context"
+	"encoding/base64"
+	"net/http"
+	"testing"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/stretchr/testify/assert"
+	"github.com/upstash/qstash-go"
+	"github.com/upstash/qstash-go/internal/signtest"
+)
+
+func TestAPIGatewayProxyHandler(t *testing.T) {
+	handler := APIGatewayProxyHandler(
+		qstash.NewReceiver(signtest.Key, signtest.Key),
+		qstash.VerifyRequestOptions{BaseUrl: "https://example.com"},
+		func(ctx context.Context, req events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
+			return events.APIGatewayProxyResponse{StatusCode: http.StatusOK}, nil
+		},
+	)
+
+	signature, err := signtest.Sign("https://example.com/orders?id=1", "body")
+	assert.NoError(t, err)
+	req := events.APIGatewayProxyRequest{
+		Path:                  "/orders",
+		QueryStringParameters: map[string]string{"id": "1"},
+		Headers:               map[string]string{"Upstash-Signature": signature},
+		Body:                  base64.StdEncoding.EncodeToString([]byte("body")),
+		IsBase64Encoded:       true,
+	}
+	res, err := handler(context.Background(), req)
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusOK, res.StatusCode)
+
+	req.Path = "/other"
+	res, err = handler(context.Background(), req)
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusUnauthorized, res.StatusCode)
+
+	// The path of the request context includes the stage of REST APIs.
+	signature, err = signtest.Sign("https://example.com/prod/orders?a=2&b=1", "body")
+	assert.NoError(t, err)
+	req = events.APIGatewayProxyRequest{
+		Path:                  "/orders",
+		RequestContext:        events.APIGatewayProxyRequestContext{Path: "/prod/orders"},
+		QueryStringParameters: map[string]string{"b": "1", "a": "2"},
+		Headers:               map[string]string{"Upstash-Signature": signature},
+		Body:                  "body",
+	}
+	res, err = handler(context.Background(), req)
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusOK, res.StatusCode)
+}
+
+func TestAPIGatewayV2HTTPHandler(t *testing.T) {
+	handler := APIGatewayV2HTTPHandler(
+		qstash.NewReceiver(signtest.Key, signtest.Key),
+		qstash.VerifyRequestOptions{BaseUrl: "https://example.com"},
+		func(ctx context.Context, req events.APIGatewayV2HTTPRequest) (events.APIGatewayV2HTTPResponse, error) {
+			return events.APIGatewayV2HTTPResponse{StatusCode: http.StatusOK}, nil
+		},
+	)
+
+	signature, err := signtest.Sign("https://example.com/orders?b=1&a=2", "body")
+	assert.NoError(t, err)
+	req := events.APIGatewayV2HTTPRequest{
+		RawPath:        "/orders",
+		RawQueryString: "b=1&a=2",
+		Headers:        map[string]string{"upstash-signature": signature},
+		Body:           "body",
+	}
+	res, err := handler(context.Background(), req)
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusOK, res.StatusCode)
+
+	req.RawQueryString = "a=2&b=1"
+	res, err = handler(context.Background(), req)
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusUnauthorized, res.StatusCode)
+}
+
+func TestFunctionURLHandler(t *testing.T) {
+	handler := FunctionURLHandler(
+		qstash.NewReceiver(signtest.Key, signtest.Key),
+		qstash.VerifyRequestOptions{},
+		func(ctx context.Context, req events.LambdaFunctionURLRequest) (events.LambdaFunctionURLResponse, error) {
+			return events.LambdaFunctionURLResponse{StatusCode: http.StatusOK}, nil
+		},
+	)
+
+	signature, err := signtest.Sign("https://example.com", "body")
+	assert.NoError(t, err)
+	req := events.LambdaFunctionURLRequest{
+		RawPath: "/",
+		Headers: map[string]string{"upstash-signature": signature},
+		Body:    "body",
+	}
+	res, err := handler(context.Background(), req)
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusOK, res.StatusCode)
+
+	req.Body = "other"
+	res, err = handler(context.Background(), req)
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusUnauthorized, res.StatusCode)
+}
@@ -0,0 +1,216 @@
+package qstash
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+)
+
+type BatchMessageResult struct {
+	// Index is the index of the message in the batch request.
+	Index int `json:"index"`
+	// MessageId is the id of the message.
+	MessageId string `json:"messageId"`
+	// Url is the url of the endpoint for the messages sent to an url group, empty otherwise.
+	Url string `json:"url,omitempty"`
+	// State is the latest state of the message.
+	State EventState `json:"state"`
+	// Error is the latest delivery error of the message, empty if there is none.
+	Error string `json:"error,omitempty"`
+}
+
+// Done reports whether the message was delivered, failed or canceled.
+func (r BatchMessageResult) Done() bool {
+	return r.State == Delivered || r.State == Failed || r.State == Canceled
+}
+
+// BatchResult is the outcome of the messages of a batch.
+type BatchResult struct {
+	// Messages is the result of each message, in the order of the batch responses.
+	Messages []BatchMessageResult `json:"messages"`
+	// CompletionMessageId is the id of the completion message, once it is published.
+	CompletionMessageId string `json:"completionMessageId,omitempty"`
+}
+
+// Done reports whether all the messages were delivered, failed or canceled.
+func (r BatchResult) Done() bool {
+	for _, m := range r.Messages {
+		if !m.Done() {
+			return false
+		}
+	}
+	return true
+}
+
+// Succeeded reports whether all the messages were delivered.
+func (r BatchResult) Succeeded() bool {
+	for _, m := range r.Messages {
+		if m.State != Delivered {
+			return false
+		}
+	}
+	return true
+}
+
+// Failed returns the results of the messages that failed or were canceled.
+func (r BatchResult) Failed() []BatchMessageResult {
+	var failed []BatchMessageResult
+	for _, m := range r.Messages {
+		if m.State == Failed || m.State == Canceled {
+			failed = append(failed, m)
+		}
+	}
+	return failed
+}
+
+// BatchError is returned when some messages of a batch were not delivered.
+type BatchError struct {
+	// Failed is the results of the messages that failed or were canceled.
+	Failed []BatchMessageResult
+	// Total is the number of messages of the batch.
+	Total int
+}
+
+func (e *BatchError) Error() string {
+	failures := make([]string, len(e.Failed))
+	for i, f := range e.Failed {
+		failures[i] = fmt.Sprintf("%s: %s", f.MessageId, strings.ToLower(string(f.State)))
+		if f.Error != "" {
+			failures[i] += fmt.Sprintf(" (%s)", f.Error)
+		}
+	}
+	return fmt.Sprintf("%d of %d messages of the batch were not delivered: %s", len(e.Failed), e.Total, strings.Join(failures, "; "))
+}
+
+const (
+	// batchLookback is how long before Wait is called the events of a batch are read from, by default.
+	batchLookback = time.Minute
+	// defaultBatchMaxErrors is the number of consecutive failed reads of the events Wait tolerates, by default.
+	defaultBatchMaxErrors = 5
+)
+
+type BatchTrackerOptions struct {
+	// Interval is the duration between two reads of the events, 1 second by default.
+	Interval time.Duration
+	// Since is the time the batch was sent, the events before it are not read.
+	// By default, the events are read from one minute before Wait is called.
+	Since time.Time
+	// Queue filters the events by queue, when the messages of the batch were all enqueued to it.
+	Queue string
+	// MaxErrors is the number of consecutive reads of the events that can fail before Wait returns the error, 5 by default.
+	// The reads that fail are retried after the interval.
+	MaxErrors int
+	// Completion is published once all the messages are delivered, if its destination is set.
+	// Its body is the JSON encoded BatchResult by default.
+	Completion PublishOptions
+	// OnProgress is called with the result so far after every read of the events, if it is set.
+	OnProgress func(result BatchResult)
+}
+
+// BatchTracker waits until the messages of a batch are delivered or failed.
+type BatchTracker struct {
+	client  *Client
+	options BatchTrackerOptions
+}
+
+func NewBatchTracker(client *Client, options BatchTrackerOptions) *BatchTracker {
+	if options.Interval <= 0 {
+		options.Interval = time.Second
+	}
+	if options.MaxErrors <= 0 {
+		options.MaxErrors = defaultBatchMaxErrors
+	}
+	return &BatchTracker{client: client, options: options}
+}
+
+// Wait waits until every message of the batch is delivered, failed or canceled, using the responses of Batch or BatchJSON.
+// Once all the messages are delivered, the completion message is published.
+// If some of the messages were not delivered, the result is returned along with a *BatchError.
+// If the context is done before, the result so far is returned along with the error of the context.
+// The events are listed once per interval, so the cost of a read does not grow with the number of messages.
+func (t *BatchTracker) Wait(ctx context.Context, responses [][]PublishOrEnqueueResponse) (result BatchResult, err error) {
+	histories := map[string]*eventHistory{}
+	for i, messages := range responses {
+		for _, response := range messages {
+			result.Messages = append(result.Messages, BatchMessageResult{
+				Index:     i,
+				MessageId: response.MessageId,
+				Url:       response.Url,
+			})
+		}
+	}
+	for _, m := range result.Messages {
+		histories[m.MessageId] = &eventHistory{}
+	}
+	filter := EventFilter{Queue: t.options.Queue, FromDate: t.options.Since}
+	if filter.FromDate.IsZero() {
+		filter.FromDate = time.Now().Add(-batchLookback)
+	}
+
+	ticker := time.NewTicker(t.options.Interval)
+	defer ticker.Stop()
+	failures := 0
+	for {
+		latest, readErr := t.client.Events().listAll(ctx, filter, histories)
+		switch {
+		case readErr == nil:
+			failures = 0
+			// The events at the latest time are read again, in case some of them were not listed yet.
+			filter.FromDate = latest
+			for i := range result.Messages {
+				history := histories[result.Messages[i].MessageId]
+				result.Messages[i].State = history.latest.State
+				result.Messages[i].Error = history.latestError.Error
+			}
+			if t.options.OnProgress != nil {
+				progress := result
+				progress.Messages = append([]BatchMessageResult(nil), result.Messages...)
+				t.options.OnProgress(progress)
+			}
+		case ctx.Err() != nil:
+			return result, ctx.Err()
+		default:
+			if failures++; failures >= t.options.MaxErrors {
+				return result, fmt.Errorf("failed to read the events of the batch: %w", readErr)
+			}
+		}
+		if result.Done() {
+			break
+		}
+		select {
+		case <-ctx.Done():
+			return result, ctx.Err()
+		case <-ticker.C:
+		}
+	}
+	if failed := result.Failed(); len(failed) > 0 {
+		return result, &BatchError{Failed: failed, Total: len(result.Messages)}
+	}
+	result.CompletionMessageId, err = t.complete(result)
+	return
+}
+
+// complete publishes the completion message, if its destination is set.
+func (t *BatchTracker) complete(result BatchResult) (string, error) {
+	completion := t.options.Completion
+	if completion.To.IsZero() && completion.Url == "" && completion.Api == "" {
+		return "", nil
+	}
+	if completion.Body == "" {
+		body, err := json.Marshal(result)
+		if err != nil {
+			return "", err
+		}
+		completion.Body = string(body)
+		if completion.ContentType == "" {
+			completion.ContentType = "application/json"
+		}
+	}
+	response, err := t.client.Publish(completion)
+	if err != nil {
+		return "", fmt.Errorf("failed to publish the completion of the batch: %w", err)
+	}
+	return response.MessageId, nil
+}
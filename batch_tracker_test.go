@@ -0,0 +1,170 @@
+package qstash_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/upstash/qstash-go"
+	"github.com/upstash/qstash-go/dev"
+)
+
+// flakyTransport fails the reads of the events while failing is set, and counts them.
+type flakyTransport struct {
+	mu      sync.Mutex
+	failing bool
+	reads   int
+}
+
+func (f *flakyTransport) RoundTrip(r *http.Request) (*http.Response, error) {
+	if r.URL.Path == "/v2/events" {
+		f.mu.Lock()
+		f.reads++
+		failing := f.failing
+		f.mu.Unlock()
+		if failing {
+			return nil, errors.New("connection reset")
+		}
+	}
+	return http.DefaultTransport.RoundTrip(r)
+}
+
+func (f *flakyTransport) set(failing bool) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.failing = failing
+}
+
+func TestBatchTracker(t *testing.T) {
+	server := dev.New(dev.Options{RetryBackoff: func(int) time.Duration { return 10 * time.Millisecond }})
+	assert.NoError(t, server.Start())
+	defer server.Close()
+	var mu sync.Mutex
+	var completions []string
+	target := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/fail" {
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+		if r.URL.Path == "/done" {
+			body, _ := io.ReadAll(r.Body)
+			mu.Lock()
+			completions = append(completions, string(body))
+			mu.Unlock()
+		}
+	}))
+	defer target.Close()
+	transport := &flakyTransport{}
+	client := qstash.NewClientWith(qstash.Options{Url: server.URL(), Token: server.Token(), Client: &http.Client{Transport: transport}})
+
+	retries := 0
+	responses, err := client.Batch([]qstash.BatchOptions{
+		{Url: target.URL + "/a"},
+		{Url: target.URL + "/b"},
+		{Url: target.URL + "/c"},
+	})
+	assert.NoError(t, err)
+
+	// The reads of the events that fail are retried.
+	transport.set(true)
+	var progress []qstash.BatchResult
+	tracker := qstash.NewBatchTracker(client, qstash.BatchTrackerOptions{
+		Interval:   20 * time.Millisecond,
+		Completion: qstash.PublishOptions{Url: target.URL + "/done"},
+		OnProgress: func(result qstash.BatchResult) {
+			progress = append(progress, result)
+		},
+	})
+	time.AfterFunc(50*time.Millisecond, func() { transport.set(false) })
+	result, err := tracker.Wait(context.Background(), responses)
+	assert.NoError(t, err)
+	assert.True(t, result.Succeeded())
+	assert.Len(t, result.Messages, 3)
+	assert.Equal(t, 2, result.Messages[2].Index)
+	assert.NotEmpty(t, progress)
+	assert.NotEmpty(t, result.CompletionMessageId)
+	assert.Eventually(t, func() bool {
+		mu.Lock()
+		defer mu.Unlock()
+		return len(completions) == 1 && strings.Contains(completions[0], responses[0][0].MessageId)
+	}, 5*time.Second, 10*time.Millisecond)
+
+	// The events are read once per interval, whatever the number of messages.
+	transport.mu.Lock()
+	transport.reads = 0
+	transport.mu.Unlock()
+	result, err = qstash.NewBatchTracker(client, qstash.BatchTrackerOptions{}).Wait(context.Background(), responses)
+	assert.NoError(t, err)
+	transport.mu.Lock()
+	assert.Equal(t, 1, transport.reads)
+	transport.mu.Unlock()
+
+	// A failed message returns an error, and the completion is not published.
+	failing, err := client.Batch([]qstash.BatchOptions{
+		{Url: target.URL + "/a", Queue: "batch"},
+		{Url: target.URL + "/fail", Queue: "batch", Retries: &retries},
+	})
+	assert.NoError(t, err)
+	result, err = qstash.NewBatchTracker(client, qstash.BatchTrackerOptions{
+		Interval:   10 * time.Millisecond,
+		Queue:      "batch",
+		Completion: qstash.PublishOptions{Url: target.URL + "/done"},
+	}).Wait(context.Background(), failing)
+	var batchErr *qstash.BatchError
+	assert.ErrorAs(t, err, &batchErr)
+	assert.Equal(t, 2, batchErr.Total)
+	assert.Equal(t, failing[1][0].MessageId, batchErr.Failed[0].MessageId)
+	assert.Contains(t, batchErr.Failed[0].Error, "500")
+	assert.False(t, result.Succeeded())
+	assert.Empty(t, result.CompletionMessageId)
+
+	// Pending messages are returned when the context is done.
+	pending, err := client.Batch([]qstash.BatchOptions{
+		{Url: target.URL + "/a", Delay: "1h"},
+	})
+	assert.NoError(t, err)
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	result, err = qstash.NewBatchTracker(client, qstash.BatchTrackerOptions{Interval: 10 * time.Millisecond}).Wait(ctx, pending)
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+	assert.False(t, result.Done())
+
+	// The reads are given up on after MaxErrors consecutive failures.
+	transport.set(true)
+	_, err = qstash.NewBatchTracker(client, qstash.BatchTrackerOptions{Interval: 10 * time.Millisecond, MaxErrors: 2}).Wait(context.Background(), pending)
+	assert.ErrorContains(t, err, "connection reset")
+}
+
+func TestBatchTrackerSameMillisecond(t *testing.T) {
+	now := time.Now().UnixMilli()
+	var mu sync.Mutex
+	reads := 0
+	// The delivery is listed after an earlier event in the same millisecond, as the events are not ordered by state.
+	pages := []string{
+		`{"events": [{"time": %d, "messageId": "msg_1", "state": "ACTIVE"}]}`,
+		`{"events": [{"time": %d, "messageId": "msg_1", "state": "DELIVERED"}, {"time": %[1]d, "messageId": "msg_1", "state": "ACTIVE"}]}`,
+	}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		page := pages[min(reads, len(pages)-1)]
+		reads++
+		mu.Unlock()
+		_, _ = w.Write([]byte(fmt.Sprintf(page, now)))
+	}))
+	defer server.Close()
+	client := qstash.NewClientWith(qstash.Options{Url: server.URL, Token: "token"})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	result, err := qstash.NewBatchTracker(client, qstash.BatchTrackerOptions{Interval: 10 * time.Millisecond}).
+		Wait(ctx, [][]qstash.PublishOrEnqueueResponse{{{MessageId: "msg_1"}}})
+	assert.NoError(t, err)
+	assert.True(t, result.Succeeded())
+}
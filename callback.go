@@ -0,0 +1,217 @@
+package qstash
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// CallbackPayload is the body of the requests QStash sends to the Callback and FailureCallback of a message,
+// describing the response of the destination to the message.
+type CallbackPayload struct {
+	// Status is the HTTP status code of the response of the destination.
+	Status int
+	// Header is the headers of the response of the destination.
+	Header http.Header
+	// Body is the body of the response of the destination.
+	Body []byte
+	// Retried is the number of retries of the message before this response.
+	Retried int
+	// MaxRetries is the maximum number of retries of the message.
+	MaxRetries int
+	// SourceMessageId is the id of the message the callback is about.
+	SourceMessageId string
+	// UrlGroup is the name of the url group if the message was sent to an url group, empty otherwise.
+	UrlGroup string
+	// EndpointName is the name of the endpoint if the message was sent to a named endpoint of an url group, empty otherwise.
+	EndpointName string
+	// Url is the destination url of the message.
+	Url string
+	// Method is the HTTP method of the message.
+	Method string
+	// SourceHeader is the headers of the message.
+	SourceHeader http.Header
+	// SourceBody is the body of the message.
+	SourceBody []byte
+	// NotBefore is the unix timestamp in milliseconds before which the message was not delivered.
+	NotBefore int64
+	// CreatedAt is the unix timestamp in milliseconds when the message was created.
+	CreatedAt int64
+	// ScheduleId is the id of the schedule if the message was created by a schedule, empty otherwise.
+	ScheduleId string
+	// CallerIP is IP address of the publisher of the message.
+	CallerIP string
+}
+
+type callbackPayloadJSON struct {
+	Status          int             `json:"status"`
+	Header          http.Header     `json:"header,omitempty"`
+	Body            []byte          `json:"body"`
+	Retried         int             `json:"retried"`
+	MaxRetries      int             `json:"maxRetries"`
+	SourceMessageId string          `json:"sourceMessageId"`
+	UrlGroup        string          `json:"topicName,omitempty"`
+	EndpointName    string          `json:"endpointName,omitempty"`
+	Url             string          `json:"url"`
+	Method          string          `json:"method"`
+	SourceHeader    http.Header     `json:"sourceHeader,omitempty"`
+	SourceBody      []byte          `json:"sourceBody"`
+	NotBefore       json.RawMessage `json:"notBefore,omitempty"`
+	CreatedAt       json.RawMessage `json:"createdAt,omitempty"`
+	ScheduleId      string          `json:"scheduleId,omitempty"`
+	CallerIP        string          `json:"callerIP,omitempty"`
+}
+
+// MarshalJSON encodes the payload as QStash does, with base64 encoded bodies and timestamps as strings.
+func (p CallbackPayload) MarshalJSON() ([]byte, error) {
+	return json.Marshal(callbackPayloadJSON{
+		Status:          p.Status,
+		Header:          p.Header,
+		Body:            p.Body,
+		Retried:         p.Retried,
+		MaxRetries:      p.MaxRetries,
+		SourceMessageId: p.SourceMessageId,
+		UrlGroup:        p.UrlGroup,
+		EndpointName:    p.EndpointName,
+		Url:             p.Url,
+		Method:          p.Method,
+		SourceHeader:    p.SourceHeader,
+		SourceBody:      p.SourceBody,
+		NotBefore:       json.RawMessage(strconv.Quote(strconv.FormatInt(p.NotBefore, 10))),
+		CreatedAt:       json.RawMessage(strconv.Quote(strconv.FormatInt(p.CreatedAt, 10))),
+		ScheduleId:      p.ScheduleId,
+		CallerIP:        p.CallerIP,
+	})
+}
+
+// UnmarshalJSON decodes the base64 encoded bodies, and the timestamps given either as numbers or as strings.
+func (p *CallbackPayload) UnmarshalJSON(data []byte) error {
+	var raw callbackPayloadJSON
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return err
+	}
+	notBefore, err := parseFlexibleInt(raw.NotBefore)
+	if err != nil {
+		return fmt.Errorf("invalid notBefore: %w", err)
+	}
+	createdAt, err := parseFlexibleInt(raw.CreatedAt)
+	if err != nil {
+		return fmt.Errorf("invalid createdAt: %w", err)
+	}
+	*p = CallbackPayload{
+		Status:          raw.Status,
+		Header:          raw.Header,
+		Body:            raw.Body,
+		Retried:         raw.Retried,
+		MaxRetries:      raw.MaxRetries,
+		SourceMessageId: raw.SourceMessageId,
+		UrlGroup:        raw.UrlGroup,
+		EndpointName:    raw.EndpointName,
+		Url:             raw.Url,
+		Method:          raw.Method,
+		SourceHeader:    raw.SourceHeader,
+		SourceBody:      raw.SourceBody,
+		NotBefore:       notBefore,
+		CreatedAt:       createdAt,
+		ScheduleId:      raw.ScheduleId,
+		CallerIP:        raw.CallerIP,
+	}
+	return nil
+}
+
+// parseFlexibleInt parses an integer encoded either as a JSON number or as a JSON string.
+func parseFlexibleInt(raw json.RawMessage) (int64, error) {
+	if len(raw) == 0 || string(raw) == "null" {
+		return 0, nil
+	}
+	var s string
+	if err := json.Unmarshal(raw, &s); err == nil {
+		if s == "" {
+			return 0, nil
+		}
+		return strconv.ParseInt(s, 10, 64)
+	}
+	var n int64
+	err := json.Unmarshal(raw, &n)
+	return n, err
+}
+
+// ParseCallbackPayload decodes the body of a callback or failure callback request.
+func ParseCallbackPayload(body []byte) (payload CallbackPayload, err error) {
+	err = json.Unmarshal(body, &payload)
+	return
+}
+
+// Succeeded reports whether the destination responded with a 2xx status code.
+func (p CallbackPayload) Succeeded() bool {
+	return p.Status >= http.StatusOK && p.Status < http.StatusMultipleChoices
+}
+
+// CreationTime returns the creation time of the message.
+func (p CallbackPayload) CreationTime() time.Time {
+	return fromUnixMilli(p.CreatedAt)
+}
+
+// NotBeforeTime returns the time before which the message was not delivered, zero if it was not set.
+func (p CallbackPayload) NotBeforeTime() time.Time {
+	return fromUnixMilli(p.NotBefore)
+}
+
+// CallbackHandler is an HTTP handler for callback and failure callback urls.
+// It verifies the signature of the requests, decodes their payload and dispatches it
+// to OnSuccess if the destination responded with a 2xx status code, or to OnFailure otherwise.
+// An error returned by the functions responds with 500 Internal Server Error, so that QStash retries the callback.
+type CallbackHandler struct {
+	Receiver *Receiver
+	// Url is the address of the handler, checked against the signature when it is not empty.
+	Url string
+	// Tolerance is the duration to tolerate when checking the signature, see VerifyOptions.
+	Tolerance time.Duration
+	OnSuccess func(ctx context.Context, payload CallbackPayload) error
+	OnFailure func(ctx context.Context, payload CallbackPayload) error
+	// ExposeErrors writes the text of the errors returned by OnSuccess and OnFailure in the response body,
+	// which QStash keeps with the failed deliveries. Only the status text is written by default.
+	ExposeErrors bool
+}
+
+func (h *CallbackHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		http.Error(w, "failed to read body", http.StatusBadRequest)
+		return
+	}
+	err = h.Receiver.Verify(VerifyOptions{
+		Signature: r.Header.Get(upstashSignatureHeader),
+		Body:      string(body),
+		Url:       h.Url,
+		Tolerance: h.Tolerance,
+	})
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+	payload, err := ParseCallbackPayload(body)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("invalid callback payload: %v", err), http.StatusBadRequest)
+		return
+	}
+	handle := h.OnFailure
+	if payload.Succeeded() {
+		handle = h.OnSuccess
+	}
+	if handle != nil {
+		if err = handle(r.Context(), payload); err != nil {
+			text := http.StatusText(http.StatusInternalServerError)
+			if h.ExposeErrors {
+				text = err.Error()
+			}
+			http.Error(w, text, http.StatusInternalServerError)
+			return
+		}
+	}
+	w.WriteHeader(http.StatusOK)
+}
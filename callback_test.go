@@ -0,0 +1,94 @@
+package qstash
+
+import (
+	"context"
+	"fmt"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseCallbackPayload(t *testing.T) {
+	payload, err := ParseCallbackPayload([]byte(`{
+		"status": 200,
+		"header": {"Content-Type": ["text/plain"]},
+		"body": "aGVsbG8=",
+		"retried": 1,
+		"maxRetries": 3,
+		"sourceMessageId": "msg_1",
+		"topicName": "group",
+		"url": "https://example.com",
+		"method": "POST",
+		"sourceBody": "d29ybGQ=",
+		"notBefore": "1700000000000",
+		"createdAt": 1700000000000
+	}`))
+	assert.NoError(t, err)
+	assert.True(t, payload.Succeeded())
+	assert.Equal(t, "hello", string(payload.Body))
+	assert.Equal(t, "world", string(payload.SourceBody))
+	assert.Equal(t, "group", payload.UrlGroup)
+	assert.Equal(t, int64(1700000000000), payload.NotBefore)
+	assert.Equal(t, time.UnixMilli(1700000000000), payload.CreationTime())
+
+	encoded, err := payload.MarshalJSON()
+	assert.NoError(t, err)
+	assert.Contains(t, string(encoded), `"createdAt":"1700000000000"`)
+	decoded, err := ParseCallbackPayload(encoded)
+	assert.NoError(t, err)
+	assert.Equal(t, payload, decoded)
+
+	_, err = ParseCallbackPayload([]byte(`{"status": 200, "createdAt": "yesterday"}`))
+	assert.ErrorContains(t, err, "invalid createdAt")
+}
+
+func TestCallbackHandler(t *testing.T) {
+	key := "test-key"
+	var succeeded, failed []CallbackPayload
+	handler := &CallbackHandler{
+		Receiver: NewReceiver(key, key),
+		Url:      "https://example.com",
+		OnSuccess: func(ctx context.Context, payload CallbackPayload) error {
+			succeeded = append(succeeded, payload)
+			return nil
+		},
+		OnFailure: func(ctx context.Context, payload CallbackPayload) error {
+			failed = append(failed, payload)
+			return fmt.Errorf("not now")
+		},
+	}
+
+	send := func(body string, signingKey string) *httptest.ResponseRecorder {
+		signature, err := sign(body, signingKey)
+		assert.NoError(t, err)
+		r := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(body))
+		r.Header.Set("Upstash-Signature", signature)
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, r)
+		return w
+	}
+
+	w := send(`{"status": 200, "sourceMessageId": "msg_1"}`, key)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Len(t, succeeded, 1)
+	assert.Equal(t, "msg_1", succeeded[0].SourceMessageId)
+
+	w = send(`{"status": 500, "sourceMessageId": "msg_2"}`, key)
+	assert.Equal(t, http.StatusInternalServerError, w.Code)
+	assert.Len(t, failed, 1)
+	assert.Equal(t, "Internal Server Error\n", w.Body.String())
+
+	handler.ExposeErrors = true
+	w = send(`{"status": 500, "sourceMessageId": "msg_2"}`, key)
+	assert.Equal(t, "not now\n", w.Body.String())
+
+	w = send(`{"status": 200}`, "wrong-key")
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+
+	w = send(`not json`, key)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Len(t, succeeded, 1)
+}
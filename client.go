@@ -9,6 +9,7 @@ import (
 	"net/url"
 	"os"
 	"strings"
+	"time"
 )
 
 const (
@@ -23,6 +24,8 @@ const (
 	upstashFailureCallbackHeader     = "Upstash-Failure-Callback"
 	upstashForwardHeader             = "Upstash-Forward"
 	upstashCronHeader                = "Upstash-Cron"
+	upstashScheduleIdHeader          = "Upstash-Schedule-Id"
+	upstashQueueNameHeader           = "Upstash-Queue-Name"
 	upstashDelayHeader               = "Upstash-Delay"
 	upstashTimeoutHeader             = "Upstash-Timeout"
 	upstashDeduplicationId           = "Upstash-Deduplication-Id"
@@ -35,7 +38,8 @@ var (
 )
 
 type Options struct {
-	// Url is the base address of QStash, it's set to https://qstash.upstash.io by default.
+	// Url is the base address of QStash.
+	// It falls back to the QSTASH_URL environment variable, and then to https://qstash.upstash.io.
 	Url string
 	// Token is the authorization token from the Upstash console.
 	Token string
@@ -71,17 +75,16 @@ func NewClientWithEnv() *Client {
 
 // NewClientWith initializes a client with the given token and HTTP client.
 func NewClientWith(options Options) *Client {
+	if options.Url == "" {
+		options.Url = os.Getenv(urlEnvProperty)
+	}
 	options.init()
 	header := http.Header{}
 	header.Set("Authorization", "Bearer "+options.Token)
-	base := os.Getenv(urlEnvProperty)
-	if base == "" {
-		base = options.Url
-	}
 	index := &Client{
 		token:   options.Token,
 		client:  options.Client,
-		url:     base,
+		url:     options.Url,
 		headers: header,
 	}
 
@@ -171,6 +174,14 @@ func parse[T any](data []byte) (t T, err error) {
 	return
 }
 
+// fromUnixMilli converts a unix timestamp in milliseconds returned by QStash to time, where 0 means unset.
+func fromUnixMilli(ms int64) time.Time {
+	if ms == 0 {
+		return time.Time{}
+	}
+	return time.UnixMilli(ms)
+}
+
 func getDestination(url string, urlGroup string, api string) (string, error) {
 	destination := ""
 	count := 0
@@ -192,6 +203,17 @@ func getDestination(url string, urlGroup string, api string) (string, error) {
 	return destination, nil
 }
 
+// getScheduleDestination validates the destination of a schedule, which can also be given with the deprecated Destination field.
+func getScheduleDestination(destination string, to Destination, url string, urlGroup string, api string) (string, error) {
+	if destination == "" {
+		return resolveDestination(to, url, urlGroup, api)
+	}
+	if !to.IsZero() || url != "" || urlGroup != "" || api != "" {
+		return "", fmt.Errorf("multiple destinations found, configure only one of To, Url, UrlGroup or Api")
+	}
+	return destination, nil
+}
+
 func prepareHeaders(
 	contentType string,
 	method string,
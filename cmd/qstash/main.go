@@ -0,0 +1,68 @@
+// Command qstash provides development utilities for QStash.
+//
+// Usage:
+//
+//	qstash dev [-addr 127.0.0.1:8080] [-forward http://localhost:3000]
+//
+// The dev command starts a local QStash compatible server and prints the environment variables
+// that point NewClientWithEnv and NewReceiverWithEnv to it.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/upstash/qstash-go/dev"
+)
+
+func main() {
+	if len(os.Args) < 2 || os.Args[1] != "dev" {
+		fmt.Fprintln(os.Stderr, "usage: qstash dev [flags]")
+		os.Exit(2)
+	}
+	if err := runDev(os.Args[2:]); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+}
+
+func runDev(args []string) error {
+	flags := flag.NewFlagSet("dev", flag.ExitOnError)
+	addr := flags.String("addr", "127.0.0.1:8080", "address to listen on")
+	forward := flags.String("forward", "", "base address of the local handler that receives all deliveries")
+	token := flags.String("token", "", "token that clients must use, generated when empty")
+	currentSigningKey := flags.String("current-signing-key", "", "current signing key, generated when empty")
+	nextSigningKey := flags.String("next-signing-key", "", "next signing key, generated when empty")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	server := dev.New(dev.Options{
+		Addr:              *addr,
+		Token:             *token,
+		CurrentSigningKey: *currentSigningKey,
+		NextSigningKey:    *nextSigningKey,
+		Forward:           *forward,
+	})
+	if err := server.Start(); err != nil {
+		return err
+	}
+	defer server.Close()
+
+	fmt.Printf("QStash development server is running at %s\n", server.URL())
+	if *forward != "" {
+		fmt.Printf("Deliveries are forwarded to %s\n", *forward)
+	}
+	fmt.Println()
+	for _, env := range server.Env() {
+		fmt.Printf("export %s\n", env)
+	}
+
+	interrupt := make(chan os.Signal, 1)
+	signal.Notify(interrupt, os.Interrupt, syscall.SIGTERM)
+	<-interrupt
+	return nil
+}
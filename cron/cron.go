@@ -0,0 +1,274 @@
+// Package cron parses and evaluates the cron expressions accepted by QStash schedules.
+//
+// An expression has five space separated fields: minute, hour, day of month, month and day of week.
+// Each field is either `*`, a value, a range such as `1-5`, a step such as `*/15` or `0-30/10`, or a comma separated list of these.
+// Months and days of week can also be given by their three letter English names, such as `JAN` or `MON`, and Sunday is either 0 or 7.
+// As in standard cron, when both the day of month and the day of week are restricted, a time matches if either of them matches.
+//
+// Expressions are evaluated in UTC, unless they are prefixed with a time zone such as `CRON_TZ=Europe/Istanbul`.
+package cron
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const timezonePrefix = "CRON_TZ="
+
+// SyntaxError describes an invalid cron expression.
+type SyntaxError struct {
+	// Expr is the expression that failed to parse.
+	Expr string
+	// Pos is the byte offset of the offending token within Expr, starting at 0.
+	Pos int
+	// Msg describes the problem.
+	Msg string
+}
+
+func (e *SyntaxError) Error() string {
+	return fmt.Sprintf("cron: invalid expression %q at position %d: %s", e.Expr, e.Pos, e.Msg)
+}
+
+type field struct {
+	name  string
+	min   int
+	max   int
+	names map[string]int
+}
+
+var (
+	minuteField = field{name: "minute", min: 0, max: 59}
+	hourField   = field{name: "hour", min: 0, max: 23}
+	domField    = field{name: "day of month", min: 1, max: 31}
+	monthField  = field{name: "month", min: 1, max: 12, names: map[string]int{
+		"JAN": 1, "FEB": 2, "MAR": 3, "APR": 4, "MAY": 5, "JUN": 6,
+		"JUL": 7, "AUG": 8, "SEP": 9, "OCT": 10, "NOV": 11, "DEC": 12,
+	}}
+	dowField = field{name: "day of week", min: 0, max: 7, names: map[string]int{
+		"SUN": 0, "MON": 1, "TUE": 2, "WED": 3, "THU": 4, "FRI": 5, "SAT": 6,
+	}}
+	fields = []field{minuteField, hourField, domField, monthField, dowField}
+)
+
+// Schedule is a parsed cron expression.
+type Schedule struct {
+	// Location is the time zone the expression is evaluated in.
+	Location *time.Location
+
+	minute, hour, dom, month, dow uint64
+	// domStar and dowStar record whether the day fields are unrestricted, which changes how days are matched.
+	domStar, dowStar bool
+}
+
+// Validate reports whether expr is a valid cron expression, returning a *SyntaxError if it is not.
+func Validate(expr string) error {
+	_, err := Parse(expr)
+	return err
+}
+
+// Parse parses a cron expression, returning a *SyntaxError if it is invalid.
+func Parse(expr string) (*Schedule, error) {
+	s := &Schedule{Location: time.UTC}
+	offset := 0
+	rest := expr
+	if strings.HasPrefix(rest, timezonePrefix) {
+		end := strings.IndexAny(rest, " \t")
+		if end < 0 {
+			return nil, &SyntaxError{Expr: expr, Pos: len(expr), Msg: "missing fields after time zone"}
+		}
+		name := rest[len(timezonePrefix):end]
+		loc, err := time.LoadLocation(name)
+		if err != nil || name == "" {
+			return nil, &SyntaxError{Expr: expr, Pos: len(timezonePrefix), Msg: fmt.Sprintf("unknown time zone %q", name)}
+		}
+		s.Location = loc
+		offset = end
+		rest = rest[end:]
+	}
+
+	tokens, positions := split(rest, offset)
+	if len(tokens) != len(fields) {
+		pos := len(expr)
+		if len(tokens) > len(fields) {
+			pos = positions[len(fields)]
+		}
+		return nil, &SyntaxError{Expr: expr, Pos: pos, Msg: fmt.Sprintf("expected %d fields, found %d", len(fields), len(tokens))}
+	}
+	bits := make([]uint64, len(fields))
+	for i, f := range fields {
+		var err error
+		bits[i], err = f.parse(tokens[i])
+		if err != nil {
+			pErr := err.(*SyntaxError)
+			pErr.Expr = expr
+			pErr.Pos += positions[i]
+			return nil, pErr
+		}
+	}
+	s.minute, s.hour, s.dom, s.month, s.dow = bits[0], bits[1], bits[2], bits[3], bits[4]
+	// Sunday can be written as both 0 and 7.
+	if s.dow&(1<<7) != 0 {
+		s.dow |= 1
+	}
+	s.domStar = tokens[2] == "*" || tokens[2] == "?"
+	s.dowStar = tokens[4] == "*" || tokens[4] == "?"
+	return s, nil
+}
+
+// split splits the expression on whitespace, returning the tokens and their absolute positions.
+func split(expr string, offset int) (tokens []string, positions []int) {
+	start := -1
+	for i := 0; i <= len(expr); i++ {
+		if i == len(expr) || expr[i] == ' ' || expr[i] == '\t' {
+			if start >= 0 {
+				tokens = append(tokens, expr[start:i])
+				positions = append(positions, offset+start)
+				start = -1
+			}
+			continue
+		}
+		if start < 0 {
+			start = i
+		}
+	}
+	return
+}
+
+func (f field) parse(token string) (uint64, error) {
+	var bits uint64
+	pos := 0
+	for _, part := range strings.Split(token, ",") {
+		b, err := f.parsePart(part, pos)
+		if err != nil {
+			return 0, err
+		}
+		bits |= b
+		pos += len(part) + 1
+	}
+	return bits, nil
+}
+
+// parsePart parses a single element of a list, pos is its offset within the field.
+func (f field) parsePart(part string, pos int) (uint64, error) {
+	if part == "" {
+		return 0, &SyntaxError{Pos: pos, Msg: fmt.Sprintf("empty %s value", f.name)}
+	}
+	rangePart, stepPart, hasStep := strings.Cut(part, "/")
+	step := 1
+	if hasStep {
+		var err error
+		step, err = strconv.Atoi(stepPart)
+		if err != nil || step <= 0 {
+			return 0, &SyntaxError{Pos: pos + len(rangePart) + 1, Msg: fmt.Sprintf("invalid %s step %q", f.name, stepPart)}
+		}
+	}
+
+	var low, high int
+	switch {
+	case rangePart == "*" || (rangePart == "?" && (f.name == domField.name || f.name == dowField.name)):
+		low, high = f.min, f.max
+		if f.name == dowField.name {
+			high = 6
+		}
+	default:
+		lowPart, highPart, isRange := strings.Cut(rangePart, "-")
+		var err error
+		if low, err = f.value(lowPart, pos); err != nil {
+			return 0, err
+		}
+		high = low
+		if isRange {
+			if high, err = f.value(highPart, pos+len(lowPart)+1); err != nil {
+				return 0, err
+			}
+			if high < low {
+				return 0, &SyntaxError{Pos: pos, Msg: fmt.Sprintf("%s range %q is reversed", f.name, rangePart)}
+			}
+		} else if hasStep {
+			// A single value with a step, such as 5/15, means from the value to the maximum.
+			high = f.max
+		}
+	}
+
+	var bits uint64
+	for v := low; v <= high; v += step {
+		bits |= 1 << uint(v)
+	}
+	return bits, nil
+}
+
+func (f field) value(token string, pos int) (int, error) {
+	if v, ok := f.names[strings.ToUpper(token)]; ok {
+		return v, nil
+	}
+	v, err := strconv.Atoi(token)
+	if err != nil {
+		return 0, &SyntaxError{Pos: pos, Msg: fmt.Sprintf("invalid %s value %q", f.name, token)}
+	}
+	if v < f.min || v > f.max {
+		return 0, &SyntaxError{Pos: pos, Msg: fmt.Sprintf("%s value %d is out of range [%d, %d]", f.name, v, f.min, f.max)}
+	}
+	return v, nil
+}
+
+// Next returns the first time after t that matches the schedule, in the location of t.
+// It returns the zero time if there is no such time within the next five years, such as for `0 0 30 2 *`.
+func (s *Schedule) Next(t time.Time) time.Time {
+	original := t.Location()
+	t = t.In(s.Location).Truncate(time.Minute).Add(time.Minute)
+	limit := t.Year() + 5
+
+wrap:
+	if t.Year() > limit {
+		return time.Time{}
+	}
+	for s.month&(1<<uint(t.Month())) == 0 {
+		t = time.Date(t.Year(), t.Month()+1, 1, 0, 0, 0, 0, s.Location)
+		if t.Month() == time.January {
+			goto wrap
+		}
+	}
+	for !s.matchesDay(t) {
+		t = time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, s.Location)
+		if t.Day() == 1 {
+			goto wrap
+		}
+	}
+	for s.hour&(1<<uint(t.Hour())) == 0 {
+		t = time.Date(t.Year(), t.Month(), t.Day(), t.Hour()+1, 0, 0, 0, s.Location)
+		if t.Hour() == 0 {
+			goto wrap
+		}
+	}
+	for s.minute&(1<<uint(t.Minute())) == 0 {
+		t = t.Add(time.Minute)
+		if t.Minute() == 0 {
+			goto wrap
+		}
+	}
+	return t.In(original)
+}
+
+// NextN returns the next n times after t that match the schedule.
+func (s *Schedule) NextN(t time.Time, n int) []time.Time {
+	times := make([]time.Time, 0, n)
+	for len(times) < n {
+		t = s.Next(t)
+		if t.IsZero() {
+			break
+		}
+		times = append(times, t)
+	}
+	return times
+}
+
+func (s *Schedule) matchesDay(t time.Time) bool {
+	dom := s.dom&(1<<uint(t.Day())) != 0
+	dow := s.dow&(1<<uint(t.Weekday())) != 0
+	if s.domStar || s.dowStar {
+		return dom && dow
+	}
+	return dom || dow
+}
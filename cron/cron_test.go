@@ -0,0 +1,98 @@
+package cron
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseErrors(t *testing.T) {
+	cases := []struct {
+		expr string
+		pos  int
+		msg  string
+	}{
+		{"* * * *", 7, "expected 5 fields, found 4"},
+		{"* * * * * *", 10, "expected 5 fields, found 6"},
+		{"60 * * * *", 0, "minute value 60 is out of range [0, 59]"},
+		{"0 25 * * *", 2, "hour value 25 is out of range [0, 23]"},
+		{"0 0 1,2,x * *", 8, `invalid day of month value "x"`},
+		{"0 0 * 1-13 *", 8, "month value 13 is out of range [1, 12]"},
+		{"*/0 * * * *", 2, `invalid minute step "0"`},
+		{"0 0 * * FRI-MON", 8, `day of week range "FRI-MON" is reversed`},
+		{"CRON_TZ=Nowhere/City 0 0 * * *", 8, `unknown time zone "Nowhere/City"`},
+		{"CRON_TZ=UTC 0 0 * * 8", 20, "day of week value 8 is out of range [0, 7]"},
+	}
+	for _, c := range cases {
+		_, err := Parse(c.expr)
+		var sErr *SyntaxError
+		if assert.True(t, errors.As(err, &sErr), c.expr) {
+			assert.Equal(t, c.pos, sErr.Pos, c.expr)
+			assert.Equal(t, c.msg, sErr.Msg, c.expr)
+		}
+	}
+}
+
+func TestValidate(t *testing.T) {
+	for _, expr := range []string{
+		"* * * * *",
+		"*/5 * * * *",
+		"0 0 1 1 *",
+		"1 1 1 1 1",
+		"0 9-17/2 * * MON-FRI",
+		"0,15,30,45 * ? * *",
+		"0 0 * JAN,jul 0,7",
+		"CRON_TZ=America/New_York 30 8 * * *",
+	} {
+		assert.NoError(t, Validate(expr), expr)
+	}
+}
+
+func TestNext(t *testing.T) {
+	start := time.Date(2024, time.February, 28, 23, 59, 30, 0, time.UTC)
+	cases := []struct {
+		expr string
+		next []time.Time
+	}{
+		{"* * * * *", []time.Time{
+			time.Date(2024, time.February, 29, 0, 0, 0, 0, time.UTC),
+			time.Date(2024, time.February, 29, 0, 1, 0, 0, time.UTC),
+		}},
+		{"0 12 29 2 *", []time.Time{
+			time.Date(2024, time.February, 29, 12, 0, 0, 0, time.UTC),
+			time.Date(2028, time.February, 29, 12, 0, 0, 0, time.UTC),
+		}},
+		{"0 0 1 * 1", []time.Time{
+			time.Date(2024, time.March, 1, 0, 0, 0, 0, time.UTC),
+			time.Date(2024, time.March, 4, 0, 0, 0, 0, time.UTC),
+		}},
+		{"*/20 9 * * SUN", []time.Time{
+			time.Date(2024, time.March, 3, 9, 0, 0, 0, time.UTC),
+			time.Date(2024, time.March, 3, 9, 20, 0, 0, time.UTC),
+			time.Date(2024, time.March, 3, 9, 40, 0, 0, time.UTC),
+		}},
+	}
+	for _, c := range cases {
+		s, err := Parse(c.expr)
+		assert.NoError(t, err)
+		assert.Equal(t, c.next, s.NextN(start, len(c.next)), c.expr)
+	}
+}
+
+func TestNextWithTimezone(t *testing.T) {
+	s, err := Parse("CRON_TZ=Europe/Istanbul 0 9 * * *")
+	assert.NoError(t, err)
+
+	next := s.Next(time.Date(2024, time.January, 1, 0, 0, 0, 0, time.UTC))
+	assert.Equal(t, time.Date(2024, time.January, 1, 6, 0, 0, 0, time.UTC), next)
+	assert.Equal(t, time.UTC, next.Location())
+}
+
+func TestNextImpossible(t *testing.T) {
+	s, err := Parse("0 0 30 2 *")
+	assert.NoError(t, err)
+	assert.True(t, s.Next(time.Now()).IsZero())
+	assert.Empty(t, s.NextN(time.Now(), 3))
+}
@@ -0,0 +1,65 @@
+package qstash
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+)
+
+const (
+	upstashSignatureHeader    = "Upstash-Signature"
+	upstashMessageIdHeader    = "Upstash-Message-Id"
+	upstashRetriedHeader      = "Upstash-Retried"
+	upstashCallerIpHeader     = "Upstash-Caller-Ip"
+	upstashTopicNameHeader    = "Upstash-Topic-Name"
+	upstashEndpointNameHeader = "Upstash-Endpoint-Name"
+)
+
+var (
+	ErrNotDelivery = fmt.Errorf("request is not a QStash delivery")
+)
+
+// DeliveryInfo is the metadata QStash sends with the headers of a delivery.
+type DeliveryInfo struct {
+	// MessageId is the id of the message, which is the same across the retries of a message.
+	MessageId string
+	// Signature is the signature of the request, see Receiver.
+	Signature string
+	// Retried is the number of times the message was retried before this delivery.
+	Retried int
+	// ScheduleId is the id of the schedule if the message was created by a schedule, empty otherwise.
+	ScheduleId string
+	// CallerIP is the ip address of the publisher of the message.
+	CallerIP string
+	// Queue is the name of the queue if the message was enqueued, empty otherwise.
+	Queue string
+	// UrlGroup is the name of the url group if the message was published to a url group, empty otherwise.
+	UrlGroup string
+	// EndpointName is the name of the url group endpoint the message is delivered to, if it has one.
+	EndpointName string
+}
+
+// ParseDelivery extracts the metadata of a delivery from the headers of the request.
+// It does not verify the signature of the request, which should be done with Receiver.
+func ParseDelivery(r *http.Request) (info DeliveryInfo, err error) {
+	info = DeliveryInfo{
+		MessageId:    r.Header.Get(upstashMessageIdHeader),
+		Signature:    r.Header.Get(upstashSignatureHeader),
+		ScheduleId:   r.Header.Get(upstashScheduleIdHeader),
+		CallerIP:     r.Header.Get(upstashCallerIpHeader),
+		Queue:        r.Header.Get(upstashQueueNameHeader),
+		UrlGroup:     r.Header.Get(upstashTopicNameHeader),
+		EndpointName: r.Header.Get(upstashEndpointNameHeader),
+	}
+	if info.MessageId == "" {
+		err = fmt.Errorf("%w: missing %s header", ErrNotDelivery, upstashMessageIdHeader)
+		return
+	}
+	if retried := r.Header.Get(upstashRetriedHeader); retried != "" {
+		if info.Retried, err = strconv.Atoi(retried); err != nil || info.Retried < 0 {
+			err = fmt.Errorf("%w: invalid %s header %q", ErrNotDelivery, upstashRetriedHeader, retried)
+			return
+		}
+	}
+	return
+}
@@ -0,0 +1,40 @@
+package qstash
+
+import (
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestParseDelivery(t *testing.T) {
+	r := httptest.NewRequest(http.MethodPost, "/", nil)
+	r.Header.Set("Upstash-Message-Id", "msg_1")
+	r.Header.Set("Upstash-Signature", "signature")
+	r.Header.Set("Upstash-Retried", "2")
+	r.Header.Set("Upstash-Schedule-Id", "scd_1")
+	r.Header.Set("Upstash-Caller-Ip", "127.0.0.1")
+	r.Header.Set("Upstash-Topic-Name", "group")
+	r.Header.Set("Upstash-Endpoint-Name", "endpoint")
+
+	info, err := ParseDelivery(r)
+	assert.NoError(t, err)
+	assert.Equal(t, DeliveryInfo{
+		MessageId:    "msg_1",
+		Signature:    "signature",
+		Retried:      2,
+		ScheduleId:   "scd_1",
+		CallerIP:     "127.0.0.1",
+		UrlGroup:     "group",
+		EndpointName: "endpoint",
+	}, info)
+
+	r.Header.Set("Upstash-Retried", "twice")
+	_, err = ParseDelivery(r)
+	assert.ErrorIs(t, err, ErrNotDelivery)
+
+	r.Header.Del("Upstash-Retried")
+	r.Header.Del("Upstash-Message-Id")
+	_, err = ParseDelivery(r)
+	assert.ErrorIs(t, err, ErrNotDelivery)
+}
@@ -0,0 +1,202 @@
+package qstash
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+type DestinationType string
+
+var (
+	DestinationUrl      DestinationType = "url"
+	DestinationUrlGroup DestinationType = "urlGroup"
+	DestinationApi      DestinationType = "api"
+)
+
+type ApiProvider string
+
+var (
+	// UpstashProvider is the provider of the apis hosted by Upstash, such as llm.
+	UpstashProvider ApiProvider = "upstash"
+	// OpenAIProvider is the chat completions api of OpenAI.
+	OpenAIProvider ApiProvider = "openai"
+	// AnthropicProvider is the messages api of Anthropic.
+	AnthropicProvider ApiProvider = "anthropic"
+	// CustomProvider is any OpenAI compatible chat completions api, at a custom base url.
+	CustomProvider ApiProvider = "custom"
+)
+
+// Destination is where a message is sent to: an url, an url group or an api.
+// It is created with ToURL, ToUrlGroup or ToAPI, which validate it,
+// and its validation error, if any, is returned by Err and by every call it is given to.
+type Destination struct {
+	kind     DestinationType
+	value    string
+	provider ApiProvider
+	// url is the address of the api of external providers, which QStash calls as a regular url.
+	url    string
+	header http.Header
+	err    error
+}
+
+// ToURL returns a destination that sends messages to an url, which must be an absolute http or https url.
+func ToURL(u string) Destination {
+	d := Destination{kind: DestinationUrl, value: u}
+	parsed, err := url.Parse(u)
+	switch {
+	case err != nil:
+		d.err = fmt.Errorf("invalid destination url %q: %w", u, err)
+	case parsed.Scheme != "http" && parsed.Scheme != "https":
+		d.err = fmt.Errorf("invalid destination url %q: scheme must be http or https", u)
+	case parsed.Host == "":
+		d.err = fmt.Errorf("invalid destination url %q: host is missing", u)
+	}
+	return d
+}
+
+// ToUrlGroup returns a destination that sends messages to every endpoint of an url group.
+func ToUrlGroup(name string) Destination {
+	d := Destination{kind: DestinationUrlGroup, value: name}
+	if name == "" || strings.Contains(name, "/") {
+		d.err = fmt.Errorf("invalid destination url group %q", name)
+	}
+	return d
+}
+
+// ToAPI returns a destination that sends messages to an api, such as llm, served by the given provider.
+// An empty provider is UpstashProvider. The other providers serve the llm api at their default base url,
+// and their api key must be forwarded in the headers of the messages, ToLLM configures both.
+func ToAPI(name string, provider ApiProvider) Destination {
+	if provider != "" && provider != UpstashProvider {
+		if name != "llm" {
+			return Destination{kind: DestinationApi, value: name, provider: provider, err: fmt.Errorf("api %q is not served by the %s provider", name, provider)}
+		}
+		return llmDestination(LlmOptions{Provider: provider})
+	}
+	d := Destination{kind: DestinationApi, value: name, provider: UpstashProvider}
+	if name == "" || strings.Contains(name, "/") {
+		d.err = fmt.Errorf("invalid destination api %q", name)
+	}
+	return d
+}
+
+// ParseDestination parses the destination of a schedule or a DLQ message, as returned by QStash.
+func ParseDestination(destination string) Destination {
+	switch {
+	case strings.HasPrefix(destination, "http://") || strings.HasPrefix(destination, "https://"):
+		return ToURL(destination)
+	case strings.HasPrefix(destination, "api/"):
+		return ToAPI(strings.TrimPrefix(destination, "api/"), UpstashProvider)
+	default:
+		return ToUrlGroup(destination)
+	}
+}
+
+// IsZero reports whether the destination is unset.
+func (d Destination) IsZero() bool {
+	return d.kind == ""
+}
+
+// Err returns the validation error of the destination, nil if it is valid.
+func (d Destination) Err() error {
+	if d.IsZero() {
+		return fmt.Errorf("destination is missing")
+	}
+	return d.err
+}
+
+// Type returns whether the destination is an url, an url group or an api.
+func (d Destination) Type() DestinationType {
+	return d.kind
+}
+
+// Url returns the url of the destination, empty if it is not an url.
+func (d Destination) Url() string {
+	if d.kind != DestinationUrl {
+		return ""
+	}
+	return d.value
+}
+
+// UrlGroup returns the name of the url group of the destination, empty if it is not an url group.
+func (d Destination) UrlGroup() string {
+	if d.kind != DestinationUrlGroup {
+		return ""
+	}
+	return d.value
+}
+
+// Api returns the name of the api of the destination, empty if it is not an api.
+func (d Destination) Api() string {
+	if d.kind != DestinationApi {
+		return ""
+	}
+	return d.value
+}
+
+// Provider returns the provider of the api of the destination, empty if it is not an api.
+func (d Destination) Provider() ApiProvider {
+	return d.provider
+}
+
+// String returns the destination in the form used by QStash: the url, the url group name or `api/<name>`.
+// The apis of providers other than Upstash are called by their url.
+func (d Destination) String() string {
+	switch {
+	case d.url != "":
+		return d.url
+	case d.kind == DestinationApi:
+		return fmt.Sprintf("api/%s", d.value)
+	default:
+		return d.value
+	}
+}
+
+// setHeaders adds the headers the destination needs, such as the api key of a provider, to the headers of a request.
+func (d Destination) setHeaders(header http.Header) http.Header {
+	for k, v := range d.header {
+		header[k] = v
+	}
+	return header
+}
+
+// Target returns the destination the message was sent to.
+func (m Message) Target() Destination {
+	switch {
+	case m.Api != "":
+		return ToAPI(m.Api, UpstashProvider)
+	case m.UrlGroup != "":
+		return ToUrlGroup(m.UrlGroup)
+	default:
+		return ToURL(m.Url)
+	}
+}
+
+// Target returns the destination the schedule sends its messages to.
+func (s Schedule) Target() Destination {
+	return ParseDestination(s.Destination)
+}
+
+// resolveDestination returns the destination path of a request, given either as a Destination or as one of the url, url group or api fields.
+func resolveDestination(to Destination, url string, urlGroup string, api string) (string, error) {
+	if to.IsZero() {
+		return getDestination(url, urlGroup, api)
+	}
+	if url != "" || urlGroup != "" || api != "" {
+		return "", fmt.Errorf("multiple destinations found, configure only one of To, Url, UrlGroup or Api")
+	}
+	if err := to.Err(); err != nil {
+		return "", err
+	}
+	return to.String(), nil
+}
+
+// resolveSingleDestination is resolveDestination for the requests that create a single message, which can not be sent to an url group.
+func resolveSingleDestination(to Destination, url string, api string) (string, error) {
+	if to.Type() == DestinationUrlGroup {
+		return "", fmt.Errorf("an url group destination creates a message per endpoint, use UrlGroups instead")
+	}
+	return resolveDestination(to, url, "", api)
+}
@@ -0,0 +1,59 @@
+package qstash
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestDestination(t *testing.T) {
+	d := ToURL("https://example.com/path?a=b")
+	assert.NoError(t, d.Err())
+	assert.Equal(t, DestinationUrl, d.Type())
+	assert.Equal(t, "https://example.com/path?a=b", d.Url())
+	assert.Empty(t, d.UrlGroup())
+
+	assert.ErrorContains(t, ToURL("example.com").Err(), "scheme must be http or https")
+	assert.ErrorContains(t, ToURL("https://").Err(), "host is missing")
+	assert.Error(t, ToUrlGroup("").Err())
+	assert.Error(t, ToAPI("", "").Err())
+	assert.ErrorContains(t, ToAPI("other", OpenAIProvider).Err(), "not served by the openai provider")
+	assert.ErrorContains(t, ToAPI("llm", CustomProvider).Err(), "`BaseUrl` must be provided")
+	assert.ErrorContains(t, Destination{}.Err(), "destination is missing")
+
+	d = ToAPI("llm", "")
+	assert.NoError(t, d.Err())
+	assert.Equal(t, UpstashProvider, d.Provider())
+	assert.Equal(t, "api/llm", d.String())
+
+	// The api key of other providers can be forwarded in the headers of the messages.
+	d = ToAPI("llm", OpenAIProvider)
+	assert.NoError(t, d.Err())
+	assert.Equal(t, OpenAIProvider, d.Provider())
+	assert.Equal(t, "https://api.openai.com/v1/chat/completions", d.String())
+
+	assert.Equal(t, ToURL("http://example.com"), ParseDestination("http://example.com"))
+	assert.Equal(t, ToUrlGroup("group"), ParseDestination("group"))
+	assert.Equal(t, ToAPI("llm", UpstashProvider), ParseDestination("api/llm"))
+
+	assert.Equal(t, ToUrlGroup("group"), Message{Url: "https://example.com", UrlGroup: "group"}.Target())
+	assert.Equal(t, ToAPI("llm", UpstashProvider), Message{Url: "https://example.com", Api: "llm"}.Target())
+	assert.Equal(t, "https://example.com", Schedule{Destination: "https://example.com"}.Target().Url())
+}
+
+func TestResolveDestination(t *testing.T) {
+	destination, err := resolveDestination(ToUrlGroup("group"), "", "", "")
+	assert.NoError(t, err)
+	assert.Equal(t, "group", destination)
+
+	_, err = resolveDestination(ToUrlGroup("group"), "https://example.com", "", "")
+	assert.ErrorContains(t, err, "multiple destinations found")
+
+	_, err = resolveDestination(ToURL("ftp://example.com"), "", "", "")
+	assert.ErrorContains(t, err, "scheme must be http or https")
+
+	_, err = resolveSingleDestination(ToUrlGroup("group"), "", "")
+	assert.ErrorContains(t, err, "use UrlGroups instead")
+
+	_, err = getScheduleDestination("https://example.com", ToURL("https://example.com"), "", "", "")
+	assert.ErrorContains(t, err, "multiple destinations found")
+}
@@ -0,0 +1,266 @@
+package dev
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/upstash/qstash-go"
+)
+
+const pollInterval = 10 * time.Millisecond
+
+// loop dispatches due messages until the server is closed.
+func (s *Server) loop() {
+	ticker := time.NewTicker(pollInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-s.ctx.Done():
+			return
+		case <-ticker.C:
+		case <-s.wake:
+		}
+		s.fireSchedules()
+		s.expireWaiters()
+		for _, m := range s.due() {
+			s.wg.Add(1)
+			go func(m *message) {
+				defer s.wg.Done()
+				status, header, body, err := s.send(m)
+				s.complete(m, status, header, body, err)
+			}(m)
+		}
+	}
+}
+
+// due marks the messages that should be delivered now as in-flight and returns them.
+// Messages in a queue are delivered in order, at most parallelism of them at a time.
+func (s *Server) due() []*message {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := time.Now()
+	inflight := map[string]int{}
+	for _, m := range s.pending {
+		if m.inflight && m.Queue != "" {
+			inflight[m.Queue]++
+		}
+	}
+	window := map[string]int{}
+	var due []*message
+	for _, m := range s.pending {
+		if m.inflight {
+			continue
+		}
+		if m.Queue != "" {
+			q := s.queue(m.Queue)
+			if q.IsPaused {
+				continue
+			}
+			window[m.Queue]++
+			if inflight[m.Queue]+window[m.Queue] > max(q.Parallelism, 1) {
+				continue
+			}
+		}
+		if m.deliverAt.After(now) {
+			continue
+		}
+		m.inflight = true
+		s.record(m, qstash.Active, "")
+		due = append(due, m)
+	}
+	return due
+}
+
+// send performs a single delivery attempt.
+func (s *Server) send(m *message) (int, http.Header, []byte, error) {
+	s.mu.Lock()
+	key := s.keys.Current
+	retried := m.retried
+	s.mu.Unlock()
+
+	signature, err := sign(key, m.Url, m.body)
+	if err != nil {
+		return 0, nil, nil, err
+	}
+	ctx := s.ctx
+	if m.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, m.timeout)
+		defer cancel()
+	}
+	target, err := s.target(m.Url)
+	if err != nil {
+		return 0, nil, nil, err
+	}
+	request, err := http.NewRequestWithContext(ctx, m.Method, target, bytes.NewReader(m.body))
+	if err != nil {
+		return 0, nil, nil, err
+	}
+	request.Header = m.Header.Clone()
+	request.Header.Set("Upstash-Signature", signature)
+	request.Header.Set("Upstash-Message-Id", m.MessageId)
+	request.Header.Set("Upstash-Retried", strconv.Itoa(retried))
+	if m.CallerIP != "" {
+		request.Header.Set("Upstash-Caller-Ip", m.CallerIP)
+	}
+	if m.ScheduleId != "" {
+		request.Header.Set("Upstash-Schedule-Id", m.ScheduleId)
+	}
+	if m.Queue != "" {
+		request.Header.Set("Upstash-Queue-Name", m.Queue)
+	}
+	if m.UrlGroup != "" {
+		request.Header.Set("Upstash-Topic-Name", m.UrlGroup)
+	}
+	if m.Endpoint != "" {
+		request.Header.Set("Upstash-Endpoint-Name", m.Endpoint)
+	}
+	response, err := s.options.Client.Do(request)
+	if err != nil {
+		return 0, nil, nil, err
+	}
+	defer response.Body.Close()
+	body, err := io.ReadAll(response.Body)
+	return response.StatusCode, response.Header, body, err
+}
+
+// target returns the address a destination is delivered to, taking Options.Forward into account.
+func (s *Server) target(destination string) (string, error) {
+	if s.options.Forward == "" {
+		return destination, nil
+	}
+	d, err := url.Parse(destination)
+	if err != nil {
+		return "", err
+	}
+	f, err := url.Parse(s.options.Forward)
+	if err != nil {
+		return "", err
+	}
+	f.Path = strings.TrimSuffix(f.Path, "/") + d.Path
+	f.RawPath = ""
+	f.RawQuery = d.RawQuery
+	return f.String(), nil
+}
+
+// complete records the outcome of a delivery attempt, and schedules a retry, callbacks or a Dlq entry.
+func (s *Server) complete(m *message, status int, header http.Header, body []byte, err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	defer s.notify()
+	m.inflight = false
+	if m.canceled {
+		return
+	}
+	if err == nil && status >= http.StatusOK && status < http.StatusMultipleChoices {
+		s.remove(m)
+		s.record(m, qstash.Delivered, "")
+		if m.Callback != "" && !m.callback {
+			s.enqueueCallback(m, m.Callback, status, header, body)
+		}
+		return
+	}
+	reason := ""
+	if err != nil {
+		reason = err.Error()
+	} else {
+		reason = fmt.Sprintf("%d %s", status, http.StatusText(status))
+	}
+	s.record(m, qstash.Error, reason)
+	// A 489 response with Upstash-NonRetryable-Error asks not to retry the message.
+	nonRetryable := status == qstash.StatusNonRetryable && header.Get("Upstash-NonRetryable-Error") == "true"
+	if m.retried < int(m.MaxRetries) && !nonRetryable {
+		m.deliverAt = time.Now().Add(s.options.RetryBackoff(m.retried))
+		m.retried++
+		s.record(m, qstash.Retry, "")
+		return
+	}
+	s.remove(m)
+	s.record(m, qstash.Failed, reason)
+	entry := qstash.DlqMessage{
+		Message:         m.Message,
+		DlqId:           randomId(""),
+		ResponseStatus:  status,
+		ResponseHeaders: header,
+	}
+	if utf8.Valid(body) {
+		entry.ResponseBody = string(body)
+	} else {
+		entry.ResponseBodyBase64 = base64.StdEncoding.EncodeToString(body)
+	}
+	s.dlq = append(s.dlq, entry)
+	if m.FailureCallback != "" && !m.callback {
+		s.enqueueCallback(m, m.FailureCallback, status, header, body)
+	}
+}
+
+// enqueueCallback publishes the callback payload describing the last delivery attempt of m.
+func (s *Server) enqueueCallback(m *message, callbackUrl string, status int, header http.Header, body []byte) {
+	payload, err := json.Marshal(qstash.CallbackPayload{
+		Status:          status,
+		Header:          header,
+		Body:            body,
+		Retried:         m.retried,
+		MaxRetries:      int(m.MaxRetries),
+		SourceMessageId: m.MessageId,
+		UrlGroup:        m.UrlGroup,
+		EndpointName:    m.Endpoint,
+		Url:             m.Url,
+		Method:          m.Method,
+		SourceHeader:    m.Header,
+		SourceBody:      m.body,
+		NotBefore:       m.NotBefore,
+		CreatedAt:       m.CreatedAt,
+		ScheduleId:      m.ScheduleId,
+		CallerIP:        m.CallerIP,
+	})
+	if err != nil {
+		return
+	}
+	now := time.Now()
+	c := &message{
+		Message: qstash.Message{
+			MessageId:  randomId("msg_"),
+			Url:        callbackUrl,
+			Method:     http.MethodPost,
+			Header:     http.Header{"Content-Type": []string{"application/json"}},
+			Body:       string(payload),
+			MaxRetries: defaultRetries,
+			NotBefore:  now.UnixMilli(),
+			CreatedAt:  now.UnixMilli(),
+		},
+		body:      payload,
+		deliverAt: now,
+		callback:  true,
+	}
+	s.pending = append(s.pending, c)
+	s.record(c, qstash.Created, "")
+}
+
+// sign issues a signature for body, in the same format as QStash.
+func sign(key string, destination string, body []byte) (string, error) {
+	hash := sha256.Sum256(body)
+	now := time.Now()
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
+		"iss":  "Upstash",
+		"sub":  destination,
+		"iat":  now.Unix(),
+		"nbf":  now.Unix(),
+		"exp":  now.Add(5 * time.Minute).Unix(),
+		"jti":  randomId("jwt_"),
+		"body": base64.URLEncoding.EncodeToString(hash[:]),
+	})
+	return token.SignedString([]byte(key))
+}
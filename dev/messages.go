@@ -0,0 +1,507 @@
+package dev
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/upstash/qstash-go"
+)
+
+const defaultRetries = 3
+
+type message struct {
+	qstash.Message
+	body      []byte
+	timeout   time.Duration
+	deliverAt time.Time
+	retried   int
+	inflight  bool
+	canceled  bool
+	// callback is set for messages that carry a callback payload, these never trigger further callbacks.
+	callback bool
+}
+
+type publishRequest struct {
+	destination string
+	queue       string
+	header      http.Header
+	body        []byte
+	scheduleId  string
+	callerIP    string
+}
+
+type statusError struct {
+	status  int
+	message string
+}
+
+func (e *statusError) Error() string {
+	return e.message
+}
+
+func badRequest(format string, args ...any) error {
+	return &statusError{status: http.StatusBadRequest, message: fmt.Sprintf(format, args...)}
+}
+
+func notFound(format string, args ...any) error {
+	return &statusError{status: http.StatusNotFound, message: fmt.Sprintf(format, args...)}
+}
+
+func writeErr(w http.ResponseWriter, err error) {
+	if sErr, ok := err.(*statusError); ok {
+		writeError(w, sErr.status, sErr.message)
+		return
+	}
+	writeError(w, http.StatusInternalServerError, err.Error())
+}
+
+// newMessage builds a message template from the Upstash-* headers of a publish request.
+func newMessage(p publishRequest) (*message, error) {
+	m := &message{
+		Message: qstash.Message{
+			Method:     http.MethodPost,
+			Header:     http.Header{},
+			MaxRetries: defaultRetries,
+			ScheduleId: p.scheduleId,
+			CallerIP:   p.callerIP,
+		},
+		body: p.body,
+	}
+	if utf8.Valid(p.body) {
+		m.Body = string(p.body)
+	} else {
+		m.BodyBase64 = base64.StdEncoding.EncodeToString(p.body)
+	}
+	now := time.Now()
+	m.deliverAt = now
+	for k, v := range p.header {
+		if len(v) == 0 {
+			continue
+		}
+		if name, ok := cutPrefixFold(k, "Upstash-Forward-"); ok {
+			m.Header.Set(name, v[0])
+			continue
+		}
+		switch http.CanonicalHeaderKey(k) {
+		case "Content-Type":
+			m.Header.Set(k, v[0])
+		case "Upstash-Method":
+			m.Method = strings.ToUpper(v[0])
+		case "Upstash-Retries":
+			retries, err := strconv.Atoi(v[0])
+			if err != nil || retries < 0 {
+				return nil, badRequest("invalid Upstash-Retries header: %q", v[0])
+			}
+			m.MaxRetries = int32(retries)
+		case "Upstash-Callback":
+			m.Callback = v[0]
+		case "Upstash-Failure-Callback":
+			m.FailureCallback = v[0]
+		case "Upstash-Delay":
+			delay, err := parseDuration(v[0])
+			if err != nil {
+				return nil, badRequest("invalid Upstash-Delay header: %q", v[0])
+			}
+			m.deliverAt = now.Add(delay)
+		case "Upstash-Not-Before":
+			notBefore, err := strconv.ParseInt(v[0], 10, 64)
+			if err != nil {
+				return nil, badRequest("invalid Upstash-Not-Before header: %q", v[0])
+			}
+			m.deliverAt = time.Unix(notBefore, 0)
+		case "Upstash-Timeout":
+			timeout, err := parseDuration(v[0])
+			if err != nil {
+				return nil, badRequest("invalid Upstash-Timeout header: %q", v[0])
+			}
+			m.timeout = timeout
+		}
+	}
+	m.NotBefore = m.deliverAt.UnixMilli()
+	m.CreatedAt = now.UnixMilli()
+	return m, nil
+}
+
+// deduplicationId returns the key used to detect duplicate publishes, empty if deduplication is not requested.
+func deduplicationId(p publishRequest) string {
+	if id := p.header.Get("Upstash-Deduplication-Id"); id != "" {
+		return p.destination + "/" + id
+	}
+	if p.header.Get("Upstash-Content-Based-Deduplication") == "true" {
+		h := sha256.New()
+		h.Write([]byte(p.destination))
+		h.Write(p.body)
+		return hex.EncodeToString(h.Sum(nil))
+	}
+	return ""
+}
+
+// publish creates the messages for a publish, enqueue or batch request.
+// The returned flag reports whether the destination is an url group.
+func (s *Server) publish(p publishRequest) ([]qstash.PublishOrEnqueueResponse, bool, error) {
+	tmpl, err := newMessage(p)
+	if err != nil {
+		return nil, false, err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	dedupId := deduplicationId(p)
+	if id, ok := s.dedup[dedupId]; ok && dedupId != "" {
+		return []qstash.PublishOrEnqueueResponse{{MessageId: id, Deduplicated: true}}, false, nil
+	}
+
+	var endpoints []qstash.Endpoint
+	urlGroup := false
+	switch {
+	case p.destination == "":
+		return nil, false, badRequest("a non-empty destination must be provided")
+	case strings.HasPrefix(p.destination, "http://") || strings.HasPrefix(p.destination, "https://"):
+		endpoints = []qstash.Endpoint{{Url: p.destination}}
+	case strings.HasPrefix(p.destination, "api/"):
+		return nil, false, badRequest("api destinations are not supported by the development server")
+	default:
+		group, ok := s.urlGroups[p.destination]
+		if !ok {
+			return nil, false, notFound("topic %s not found", p.destination)
+		}
+		endpoints = group.Endpoints
+		urlGroup = true
+	}
+	if p.queue != "" {
+		s.queue(p.queue)
+	}
+
+	responses := make([]qstash.PublishOrEnqueueResponse, 0, len(endpoints))
+	for _, endpoint := range endpoints {
+		m := *tmpl
+		m.MessageId = randomId("msg_")
+		m.Url = endpoint.Url
+		m.Endpoint = endpoint.Name
+		m.Queue = p.queue
+		if urlGroup {
+			m.UrlGroup = p.destination
+		}
+		s.pending = append(s.pending, &m)
+		s.record(&m, qstash.Created, "")
+
+		response := qstash.PublishOrEnqueueResponse{MessageId: m.MessageId}
+		if urlGroup {
+			response.Url = endpoint.Url
+			response.EndpointName = endpoint.Name
+		}
+		responses = append(responses, response)
+	}
+	if dedupId != "" && len(responses) > 0 {
+		s.dedup[dedupId] = responses[0].MessageId
+	}
+	s.notify()
+	return responses, urlGroup, nil
+}
+
+func (s *Server) handlePublish(w http.ResponseWriter, r *http.Request, queue string, destination string) {
+	if r.Method != http.MethodPost {
+		writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "failed to read body: %v", err)
+		return
+	}
+	responses, urlGroup, err := s.publish(publishRequest{
+		destination: destination,
+		queue:       queue,
+		header:      r.Header,
+		body:        body,
+		callerIP:    callerIP(r),
+	})
+	if err != nil {
+		writeErr(w, err)
+		return
+	}
+	if urlGroup {
+		writeJSON(w, http.StatusCreated, responses)
+		return
+	}
+	writeJSON(w, http.StatusCreated, responses[0])
+}
+
+type batchMessage struct {
+	Destination string            `json:"destination"`
+	Headers     map[string]string `json:"headers"`
+	Body        string            `json:"body"`
+	Queue       string            `json:"queue"`
+}
+
+func (s *Server) handleBatch(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+	var messages []batchMessage
+	if err := json.NewDecoder(r.Body).Decode(&messages); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid batch request: %v", err)
+		return
+	}
+	results := make([]any, 0, len(messages))
+	for _, bm := range messages {
+		header := http.Header{}
+		for k, v := range bm.Headers {
+			header.Set(k, v)
+		}
+		responses, urlGroup, err := s.publish(publishRequest{
+			destination: bm.Destination,
+			queue:       bm.Queue,
+			header:      header,
+			body:        []byte(bm.Body),
+			callerIP:    callerIP(r),
+		})
+		if err != nil {
+			writeErr(w, err)
+			return
+		}
+		if urlGroup {
+			results = append(results, responses)
+		} else {
+			results = append(results, responses[0])
+		}
+	}
+	writeJSON(w, http.StatusCreated, results)
+}
+
+func (s *Server) handleMessages(w http.ResponseWriter, r *http.Request, messageId string) {
+	switch {
+	case r.Method == http.MethodGet && messageId != "":
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		m := s.find(messageId)
+		if m == nil {
+			writeError(w, http.StatusNotFound, "message %s not found", messageId)
+			return
+		}
+		writeJSON(w, http.StatusOK, m.Message)
+	case r.Method == http.MethodDelete && messageId != "":
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		m := s.find(messageId)
+		if m == nil {
+			writeError(w, http.StatusNotFound, "message %s not found", messageId)
+			return
+		}
+		s.cancelMessage(m)
+		w.WriteHeader(http.StatusAccepted)
+	case r.Method == http.MethodDelete:
+		var request struct {
+			MessageIds []string `json:"messageIds"`
+		}
+		body, err := io.ReadAll(r.Body)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, "failed to read body: %v", err)
+			return
+		}
+		if len(body) > 0 {
+			if err = json.Unmarshal(body, &request); err != nil {
+				writeError(w, http.StatusBadRequest, "invalid request: %v", err)
+				return
+			}
+		}
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		var targets []*message
+		if request.MessageIds == nil {
+			targets = append(targets, s.pending...)
+		} else {
+			for _, id := range request.MessageIds {
+				if m := s.find(id); m != nil {
+					targets = append(targets, m)
+				}
+			}
+		}
+		for _, m := range targets {
+			s.cancelMessage(m)
+		}
+		writeJSON(w, http.StatusOK, map[string]int{"cancelled": len(targets)})
+	default:
+		writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+	}
+}
+
+func (s *Server) find(messageId string) *message {
+	for _, m := range s.pending {
+		if m.MessageId == messageId {
+			return m
+		}
+	}
+	return nil
+}
+
+func (s *Server) remove(m *message) {
+	for i, p := range s.pending {
+		if p == m {
+			s.pending = append(s.pending[:i], s.pending[i+1:]...)
+			return
+		}
+	}
+}
+
+func (s *Server) cancelMessage(m *message) {
+	m.canceled = true
+	s.remove(m)
+	s.record(m, qstash.CancelRequested, "")
+	s.record(m, qstash.Canceled, "")
+}
+
+func (s *Server) record(m *message, state qstash.EventState, reason string) {
+	event := qstash.Event{
+		Time:         time.Now().UnixMilli(),
+		MessageId:    m.MessageId,
+		State:        state,
+		Error:        reason,
+		Url:          m.Url,
+		UrlGroup:     m.UrlGroup,
+		EndpointName: m.Endpoint,
+		QueueName:    m.Queue,
+		ScheduleId:   m.ScheduleId,
+	}
+	if state == qstash.Retry {
+		event.NextDeliveryTime = m.deliverAt.UnixMilli()
+	}
+	s.events = append(s.events, event)
+	if sc, ok := s.schedules[m.ScheduleId]; ok {
+		if _, ok := sc.LastScheduleStates[m.MessageId]; ok {
+			sc.LastScheduleStates[m.MessageId] = string(state)
+		}
+	}
+}
+
+func (s *Server) handleEvents(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+	params := r.URL.Query()
+	from, to, err := dateRange(params.Get("fromDate"), params.Get("toDate"))
+	if err != nil {
+		writeErr(w, err)
+		return
+	}
+	s.mu.Lock()
+	var events []qstash.Event
+	for i := len(s.events) - 1; i >= 0; i-- {
+		e := s.events[i]
+		if matches(params, "messageId", e.MessageId) &&
+			matches(params, "state", string(e.State)) &&
+			matches(params, "url", e.Url) &&
+			matches(params, "topicName", e.UrlGroup) &&
+			matches(params, "scheduleId", e.ScheduleId) &&
+			matches(params, "queueName", e.QueueName) &&
+			matches(params, "api", e.Api) &&
+			e.Time >= from && e.Time <= to {
+			events = append(events, e)
+		}
+	}
+	s.mu.Unlock()
+	page, cursor, err := paginate(events, params.Get("cursor"), params.Get("count"), 1000)
+	if err != nil {
+		writeErr(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]any{"events": page, "cursor": cursor})
+}
+
+func matches(params map[string][]string, key string, value string) bool {
+	expected, ok := params[key]
+	return !ok || len(expected) == 0 || expected[0] == value
+}
+
+func dateRange(fromDate string, toDate string) (from int64, to int64, err error) {
+	to = int64(^uint64(0) >> 1)
+	if fromDate != "" {
+		if from, err = strconv.ParseInt(fromDate, 10, 64); err != nil {
+			return 0, 0, badRequest("invalid fromDate: %q", fromDate)
+		}
+	}
+	if toDate != "" {
+		if to, err = strconv.ParseInt(toDate, 10, 64); err != nil {
+			return 0, 0, badRequest("invalid toDate: %q", toDate)
+		}
+	}
+	return from, to, nil
+}
+
+// paginate returns the page starting at the offset encoded in the cursor, and the cursor of the next page.
+func paginate[T any](items []T, cursor string, count string, limit int) ([]T, string, error) {
+	offset := 0
+	if cursor != "" {
+		var err error
+		if offset, err = strconv.Atoi(cursor); err != nil || offset < 0 {
+			return nil, "", badRequest("invalid cursor: %q", cursor)
+		}
+	}
+	if count != "" {
+		n, err := strconv.Atoi(count)
+		if err != nil || n <= 0 {
+			return nil, "", badRequest("invalid count: %q", count)
+		}
+		limit = min(n, limit)
+	}
+	if offset >= len(items) {
+		return []T{}, "", nil
+	}
+	end := min(offset+limit, len(items))
+	next := ""
+	if end < len(items) {
+		next = strconv.Itoa(end)
+	}
+	return items[offset:end], next, nil
+}
+
+// parseDuration parses durations in the QStash format, such as 10s, 5m, 2h or 1d.
+func parseDuration(value string) (time.Duration, error) {
+	if days, ok := strings.CutSuffix(value, "d"); ok {
+		n, err := strconv.Atoi(days)
+		if err != nil {
+			return 0, err
+		}
+		return time.Duration(n) * 24 * time.Hour, nil
+	}
+	if n, err := strconv.Atoi(value); err == nil {
+		return time.Duration(n) * time.Second, nil
+	}
+	return time.ParseDuration(value)
+}
+
+func cutPrefixFold(s string, prefix string) (string, bool) {
+	if len(s) > len(prefix) && strings.EqualFold(s[:len(prefix)], prefix) {
+		return s[len(prefix):], true
+	}
+	return "", false
+}
+
+func callerIP(r *http.Request) string {
+	host := r.RemoteAddr
+	if i := strings.LastIndex(host, ":"); i >= 0 {
+		host = host[:i]
+	}
+	return strings.Trim(host, "[]")
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
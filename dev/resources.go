@@ -0,0 +1,468 @@
+package dev
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/upstash/qstash-go"
+	"github.com/upstash/qstash-go/cron"
+)
+
+type schedule struct {
+	qstash.Schedule
+	// header and body are the original publish request of the schedule, they are replayed on each firing.
+	header http.Header
+	body   []byte
+	cron   *cron.Schedule
+}
+
+// queue returns the queue with the given name, creating it if it does not exist.
+func (s *Server) queue(name string) *qstash.QueueWithLag {
+	q, ok := s.queues[name]
+	if !ok {
+		now := time.Now().UnixMilli()
+		q = &qstash.QueueWithLag{Name: name, Parallelism: 1, CreatedAt: now, UpdatedAt: now}
+		s.queues[name] = q
+	}
+	return q
+}
+
+func (s *Server) lag(name string) int64 {
+	var lag int64
+	for _, m := range s.pending {
+		if m.Queue == name {
+			lag++
+		}
+	}
+	return lag
+}
+
+func (s *Server) handleQueues(w http.ResponseWriter, r *http.Request, rest string) {
+	name, action, _ := strings.Cut(rest, "/")
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	switch {
+	case r.Method == http.MethodPost && name == "":
+		var request qstash.Queue
+		if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+			writeError(w, http.StatusBadRequest, "invalid request: %v", err)
+			return
+		}
+		if request.Name == "" {
+			writeError(w, http.StatusBadRequest, "queueName is required")
+			return
+		}
+		q := s.queue(request.Name)
+		q.Parallelism = max(request.Parallelism, 1)
+		q.IsPaused = request.IsPaused
+		q.UpdatedAt = time.Now().UnixMilli()
+		s.notify()
+		w.WriteHeader(http.StatusOK)
+	case r.Method == http.MethodGet && name == "":
+		queues := make([]qstash.QueueWithLag, 0, len(s.queues))
+		for _, key := range sortedKeys(s.queues) {
+			q := *s.queues[key]
+			q.Lag = s.lag(key)
+			queues = append(queues, q)
+		}
+		writeJSON(w, http.StatusOK, queues)
+	case r.Method == http.MethodGet && action == "":
+		q, ok := s.queues[name]
+		if !ok {
+			writeError(w, http.StatusNotFound, "queue %s not found", name)
+			return
+		}
+		result := *q
+		result.Lag = s.lag(name)
+		writeJSON(w, http.StatusOK, result)
+	case r.Method == http.MethodDelete && action == "":
+		if _, ok := s.queues[name]; !ok {
+			writeError(w, http.StatusNotFound, "queue %s not found", name)
+			return
+		}
+		for _, m := range append([]*message(nil), s.pending...) {
+			if m.Queue == name {
+				s.cancelMessage(m)
+			}
+		}
+		delete(s.queues, name)
+		w.WriteHeader(http.StatusOK)
+	case r.Method == http.MethodPost && (action == "pause" || action == "resume"):
+		q, ok := s.queues[name]
+		if !ok {
+			writeError(w, http.StatusNotFound, "queue %s not found", name)
+			return
+		}
+		q.IsPaused = action == "pause"
+		q.UpdatedAt = time.Now().UnixMilli()
+		s.notify()
+		w.WriteHeader(http.StatusOK)
+	default:
+		writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+	}
+}
+
+func (s *Server) handleUrlGroups(w http.ResponseWriter, r *http.Request, rest string) {
+	name, action, _ := strings.Cut(rest, "/")
+	switch {
+	case action == "endpoints" && (r.Method == http.MethodPost || r.Method == http.MethodDelete):
+		var request struct {
+			Endpoints []qstash.Endpoint `json:"endpoints"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+			writeError(w, http.StatusBadRequest, "invalid request: %v", err)
+			return
+		}
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		if r.Method == http.MethodPost {
+			s.upsertEndpoints(name, request.Endpoints)
+		} else {
+			s.removeEndpoints(name, request.Endpoints)
+		}
+		w.WriteHeader(http.StatusOK)
+	case r.Method == http.MethodGet && name == "":
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		groups := make([]qstash.UrlGroup, 0, len(s.urlGroups))
+		for _, key := range sortedKeys(s.urlGroups) {
+			groups = append(groups, *s.urlGroups[key])
+		}
+		writeJSON(w, http.StatusOK, groups)
+	case r.Method == http.MethodGet && action == "":
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		group, ok := s.urlGroups[name]
+		if !ok {
+			writeError(w, http.StatusNotFound, "topic %s not found", name)
+			return
+		}
+		writeJSON(w, http.StatusOK, group)
+	case r.Method == http.MethodDelete && action == "":
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		delete(s.urlGroups, name)
+		w.WriteHeader(http.StatusOK)
+	default:
+		writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+	}
+}
+
+func (s *Server) upsertEndpoints(name string, endpoints []qstash.Endpoint) {
+	now := time.Now().UnixMilli()
+	group, ok := s.urlGroups[name]
+	if !ok {
+		group = &qstash.UrlGroup{Name: name, CreatedAt: now}
+		s.urlGroups[name] = group
+	}
+	group.UpdatedAt = now
+	for _, endpoint := range endpoints {
+		replaced := false
+		for i, existing := range group.Endpoints {
+			if existing.Url == endpoint.Url || (endpoint.Name != "" && existing.Name == endpoint.Name) {
+				group.Endpoints[i] = endpoint
+				replaced = true
+				break
+			}
+		}
+		if !replaced {
+			group.Endpoints = append(group.Endpoints, endpoint)
+		}
+	}
+}
+
+// removeEndpoints removes the endpoints matching either by url or name, and deletes the group once it is empty.
+func (s *Server) removeEndpoints(name string, endpoints []qstash.Endpoint) {
+	group, ok := s.urlGroups[name]
+	if !ok {
+		return
+	}
+	kept := group.Endpoints[:0]
+	for _, existing := range group.Endpoints {
+		removed := false
+		for _, endpoint := range endpoints {
+			if (endpoint.Url != "" && endpoint.Url == existing.Url) || (endpoint.Name != "" && endpoint.Name == existing.Name) {
+				removed = true
+				break
+			}
+		}
+		if !removed {
+			kept = append(kept, existing)
+		}
+	}
+	group.Endpoints = kept
+	group.UpdatedAt = time.Now().UnixMilli()
+	if len(group.Endpoints) == 0 {
+		delete(s.urlGroups, name)
+	}
+}
+
+func (s *Server) handleSchedules(w http.ResponseWriter, r *http.Request, rest string) {
+	id, action, _ := strings.Cut(rest, "/")
+	switch {
+	case r.Method == http.MethodPost && rest != "":
+		s.createSchedule(w, r, destination(rest, r.URL))
+	case r.Method == http.MethodGet && rest == "":
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		schedules := make([]qstash.Schedule, 0, len(s.schedules))
+		for _, sc := range s.schedules {
+			schedules = append(schedules, sc.Schedule)
+		}
+		sort.Slice(schedules, func(i, j int) bool {
+			return schedules[i].CreatedAt < schedules[j].CreatedAt
+		})
+		writeJSON(w, http.StatusOK, schedules)
+	case r.Method == http.MethodGet && action == "":
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		sc, ok := s.schedules[id]
+		if !ok {
+			writeError(w, http.StatusNotFound, "schedule %s not found", id)
+			return
+		}
+		writeJSON(w, http.StatusOK, sc.Schedule)
+	case r.Method == http.MethodPatch && (action == "pause" || action == "resume"):
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		sc, ok := s.schedules[id]
+		if !ok {
+			writeError(w, http.StatusNotFound, "schedule %s not found", id)
+			return
+		}
+		sc.IsPaused = action == "pause"
+		w.WriteHeader(http.StatusOK)
+	case r.Method == http.MethodDelete && action == "":
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		delete(s.schedules, id)
+		w.WriteHeader(http.StatusOK)
+	default:
+		writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+	}
+}
+
+func (s *Server) createSchedule(w http.ResponseWriter, r *http.Request, destination string) {
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "failed to read body: %v", err)
+		return
+	}
+	expr := r.Header.Get("Upstash-Cron")
+	if expr == "" {
+		writeError(w, http.StatusBadRequest, "Upstash-Cron header is required")
+		return
+	}
+	parsed, err := cron.Parse(expr)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	scheduleId := r.Header.Get("Upstash-Schedule-Id")
+	if scheduleId == "" {
+		scheduleId = randomId("scd_")
+	}
+	header := r.Header.Clone()
+	header.Del("Authorization")
+	header.Del("Upstash-Cron")
+	header.Del("Upstash-Schedule-Id")
+	queueName := header.Get("Upstash-Queue-Name")
+	header.Del("Upstash-Queue-Name")
+	tmpl, err := newMessage(publishRequest{destination: destination, header: header, body: body})
+	if err != nil {
+		writeErr(w, err)
+		return
+	}
+	var delay int32
+	if value := header.Get("Upstash-Delay"); value != "" {
+		d, _ := parseDuration(value)
+		delay = int32(d / time.Second)
+	}
+	var timeout int32
+	if value := header.Get("Upstash-Timeout"); value != "" {
+		d, _ := parseDuration(value)
+		timeout = int32(d / time.Second)
+	}
+	now := time.Now()
+	sc := &schedule{
+		Schedule: qstash.Schedule{
+			Id:               scheduleId,
+			CreatedAt:        now.UnixMilli(),
+			Cron:             expr,
+			NextScheduleTime: parsed.Next(now).UnixMilli(),
+			Destination:      destination,
+			QueueName:        queueName,
+			Method:           tmpl.Method,
+			Header:           tmpl.Header,
+			Body:             tmpl.Body,
+			BodyBase64:       tmpl.BodyBase64,
+			Retries:          tmpl.MaxRetries,
+			Delay:            delay,
+			Timeout:          timeout,
+			Callback:         tmpl.Callback,
+			FailureCallback:  tmpl.FailureCallback,
+			CallerIP:         callerIP(r),
+		},
+		header: header,
+		body:   body,
+		cron:   parsed,
+	}
+	s.mu.Lock()
+	// Creating a schedule with the id of an existing one updates it in place.
+	if existing, ok := s.schedules[sc.Id]; ok {
+		sc.CreatedAt = existing.CreatedAt
+		sc.IsPaused = existing.IsPaused
+		sc.LastScheduleTime = existing.LastScheduleTime
+		sc.LastScheduleStates = existing.LastScheduleStates
+	}
+	s.schedules[sc.Id] = sc
+	s.mu.Unlock()
+	writeJSON(w, http.StatusCreated, map[string]string{"scheduleId": sc.Id})
+}
+
+// fireSchedules publishes the messages of the schedules that are due.
+func (s *Server) fireSchedules() {
+	now := time.Now()
+	s.mu.Lock()
+	var due []*schedule
+	for _, sc := range s.schedules {
+		if sc.IsPaused || sc.NextScheduleTime == 0 || sc.NextScheduleTime > now.UnixMilli() {
+			continue
+		}
+		sc.LastScheduleTime = now.UnixMilli()
+		sc.NextScheduleTime = sc.cron.Next(now).UnixMilli()
+		due = append(due, sc)
+	}
+	s.mu.Unlock()
+
+	for _, sc := range due {
+		responses, _, err := s.publish(publishRequest{
+			destination: sc.Destination,
+			queue:       sc.QueueName,
+			header:      sc.header,
+			body:        sc.body,
+			scheduleId:  sc.Id,
+			callerIP:    sc.CallerIP,
+		})
+		if err != nil {
+			continue
+		}
+		s.mu.Lock()
+		sc.LastScheduleStates = map[string]string{}
+		for _, response := range responses {
+			sc.LastScheduleStates[response.MessageId] = s.state(response.MessageId)
+		}
+		s.mu.Unlock()
+	}
+}
+
+// state returns the last recorded state of a message.
+func (s *Server) state(messageId string) string {
+	for i := len(s.events) - 1; i >= 0; i-- {
+		if s.events[i].MessageId == messageId {
+			return string(s.events[i].State)
+		}
+	}
+	return ""
+}
+
+func (s *Server) handleDlq(w http.ResponseWriter, r *http.Request, dlqId string) {
+	switch {
+	case r.Method == http.MethodGet && dlqId == "":
+		params := r.URL.Query()
+		from, to, err := dateRange(params.Get("fromDate"), params.Get("toDate"))
+		if err != nil {
+			writeErr(w, err)
+			return
+		}
+		s.mu.Lock()
+		var messages []qstash.DlqMessage
+		for i := len(s.dlq) - 1; i >= 0; i-- {
+			m := s.dlq[i]
+			if matches(params, "messageId", m.MessageId) &&
+				matches(params, "url", m.Url) &&
+				matches(params, "topicName", m.UrlGroup) &&
+				matches(params, "scheduleId", m.ScheduleId) &&
+				matches(params, "queueName", m.Queue) &&
+				matches(params, "api", m.Api) &&
+				matches(params, "responseStatus", strconv.Itoa(m.ResponseStatus)) &&
+				matches(params, "callerIp", m.CallerIP) &&
+				m.CreatedAt >= from && m.CreatedAt <= to {
+				messages = append(messages, m)
+			}
+		}
+		s.mu.Unlock()
+		page, cursor, err := paginate(messages, params.Get("cursor"), params.Get("count"), 100)
+		if err != nil {
+			writeErr(w, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, map[string]any{"messages": page, "cursor": cursor})
+	case r.Method == http.MethodGet:
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		for _, m := range s.dlq {
+			if m.DlqId == dlqId {
+				writeJSON(w, http.StatusOK, m)
+				return
+			}
+		}
+		writeError(w, http.StatusNotFound, "dlq message %s not found", dlqId)
+	case r.Method == http.MethodDelete && dlqId != "":
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		if s.deleteDlq([]string{dlqId}) == 0 {
+			writeError(w, http.StatusNotFound, "dlq message %s not found", dlqId)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	case r.Method == http.MethodDelete:
+		var request struct {
+			DlqIds []string `json:"dlqIds"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+			writeError(w, http.StatusBadRequest, "invalid request: %v", err)
+			return
+		}
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		writeJSON(w, http.StatusOK, map[string]int{"deleted": s.deleteDlq(request.DlqIds)})
+	default:
+		writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+	}
+}
+
+func (s *Server) deleteDlq(dlqIds []string) int {
+	ids := map[string]bool{}
+	for _, id := range dlqIds {
+		ids[id] = true
+	}
+	kept := s.dlq[:0]
+	for _, m := range s.dlq {
+		if !ids[m.DlqId] {
+			kept = append(kept, m)
+		}
+	}
+	deleted := len(s.dlq) - len(kept)
+	s.dlq = kept
+	return deleted
+}
+
+func (s *Server) handleKeys(w http.ResponseWriter, r *http.Request, rotate bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	switch {
+	case r.Method == http.MethodGet && !rotate:
+		writeJSON(w, http.StatusOK, s.keys)
+	case r.Method == http.MethodPost && rotate:
+		s.keys = qstash.SigningKeys{Current: s.keys.Next, Next: randomId("sig_")}
+		writeJSON(w, http.StatusOK, s.keys)
+	default:
+		writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+	}
+}
@@ -0,0 +1,267 @@
+// Package dev provides a local, QStash compatible development server.
+//
+// The server implements the parts of the QStash REST API used by the SDK,
+// so that the whole publish, sign, deliver and verify loop can run on a single machine,
+// without deploying the consumer or exposing it through a tunnel.
+// Messages are signed with locally generated signing keys, which can be verified with a regular qstash.Receiver.
+package dev
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/upstash/qstash-go"
+)
+
+type Options struct {
+	// Addr is the TCP address to listen on, a random port on the loopback interface is used by default.
+	Addr string
+	// Token is the token that clients must use to authorize, a random token is generated by default.
+	Token string
+	// CurrentSigningKey is the key used to sign deliveries, a random key is generated by default.
+	CurrentSigningKey string
+	// NextSigningKey is the key that becomes current after a rotation, a random key is generated by default.
+	NextSigningKey string
+	// Forward is the base address of a local handler, such as http://localhost:3000.
+	// When set, the path and query of each destination are kept, but the delivery is sent to this address instead.
+	// The signature is still issued for the original destination.
+	Forward string
+	// Client is the HTTP client used for deliveries, http.DefaultClient is used by default.
+	Client *http.Client
+	// RetryBackoff returns the delay before the next delivery attempt, given the number of attempts so far.
+	// By default, it doubles starting from one second.
+	RetryBackoff func(retried int) time.Duration
+}
+
+func (o *Options) init() {
+	if o.Addr == "" {
+		o.Addr = "127.0.0.1:0"
+	}
+	if o.Token == "" {
+		o.Token = randomId("dev_")
+	}
+	if o.CurrentSigningKey == "" {
+		o.CurrentSigningKey = randomId("sig_")
+	}
+	if o.NextSigningKey == "" {
+		o.NextSigningKey = randomId("sig_")
+	}
+	if o.Client == nil {
+		o.Client = http.DefaultClient
+	}
+	if o.RetryBackoff == nil {
+		o.RetryBackoff = func(retried int) time.Duration {
+			return time.Duration(1<<retried) * time.Second
+		}
+	}
+}
+
+// Server is an in-memory QStash stand-in.
+// All state is lost once the server is closed.
+type Server struct {
+	options  Options
+	listener net.Listener
+	server   *http.Server
+	ctx      context.Context
+	cancel   context.CancelFunc
+	wg       sync.WaitGroup
+	wake     chan struct{}
+
+	mu        sync.Mutex
+	keys      qstash.SigningKeys
+	pending   []*message
+	events    []qstash.Event
+	dlq       []qstash.DlqMessage
+	queues    map[string]*qstash.QueueWithLag
+	urlGroups map[string]*qstash.UrlGroup
+	schedules map[string]*schedule
+	dedup     map[string]string
+	waiters   []*waiter
+}
+
+// New creates a development server with the given options, the server must be started with Start.
+func New(options Options) *Server {
+	options.init()
+	ctx, cancel := context.WithCancel(context.Background())
+	return &Server{
+		options: options,
+		ctx:     ctx,
+		cancel:  cancel,
+		wake:    make(chan struct{}, 1),
+		keys: qstash.SigningKeys{
+			Current: options.CurrentSigningKey,
+			Next:    options.NextSigningKey,
+		},
+		queues:    map[string]*qstash.QueueWithLag{},
+		urlGroups: map[string]*qstash.UrlGroup{},
+		schedules: map[string]*schedule{},
+		dedup:     map[string]string{},
+	}
+}
+
+// Start starts listening for API requests and delivering messages in the background.
+func (s *Server) Start() error {
+	listener, err := net.Listen("tcp", s.options.Addr)
+	if err != nil {
+		return err
+	}
+	s.listener = listener
+	s.server = &http.Server{Handler: s}
+	s.wg.Add(2)
+	go func() {
+		defer s.wg.Done()
+		if err := s.server.Serve(listener); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			s.cancel()
+		}
+	}()
+	go func() {
+		defer s.wg.Done()
+		s.loop()
+	}()
+	return nil
+}
+
+// Close stops the server and aborts in-flight deliveries.
+func (s *Server) Close() error {
+	s.cancel()
+	var err error
+	if s.server != nil {
+		err = s.server.Close()
+	}
+	s.wg.Wait()
+	return err
+}
+
+// URL returns the base address of the server.
+func (s *Server) URL() string {
+	if s.listener == nil {
+		return ""
+	}
+	return "http://" + s.listener.Addr().String()
+}
+
+// Token returns the token that clients must use to authorize.
+func (s *Server) Token() string {
+	return s.options.Token
+}
+
+// SigningKeys returns the signing keys that are currently used to sign deliveries.
+func (s *Server) SigningKeys() qstash.SigningKeys {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.keys
+}
+
+// Client returns a client that targets the server.
+func (s *Server) Client() *qstash.Client {
+	return qstash.NewClientWith(qstash.Options{
+		Url:   s.URL(),
+		Token: s.options.Token,
+	})
+}
+
+// Receiver returns a receiver that verifies signatures issued by the server.
+func (s *Server) Receiver() *qstash.Receiver {
+	keys := s.SigningKeys()
+	return qstash.NewReceiver(keys.Current, keys.Next)
+}
+
+// Env returns the environment variables, in KEY=value form,
+// that point NewClientWithEnv and NewReceiverWithEnv to the server.
+func (s *Server) Env() []string {
+	keys := s.SigningKeys()
+	return []string{
+		"QSTASH_URL=" + s.URL(),
+		"QSTASH_TOKEN=" + s.options.Token,
+		"QSTASH_CURRENT_SIGNING_KEY=" + keys.Current,
+		"QSTASH_NEXT_SIGNING_KEY=" + keys.Next,
+	}
+}
+
+// ServeHTTP serves the QStash REST API.
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Header.Get("Authorization") != "Bearer "+s.options.Token {
+		writeError(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+	path, found := strings.CutPrefix(r.URL.Path, "/v2/")
+	if !found {
+		writeError(w, http.StatusNotFound, "not found")
+		return
+	}
+	resource, rest, _ := strings.Cut(path, "/")
+	switch resource {
+	case "publish":
+		s.handlePublish(w, r, "", destination(rest, r.URL))
+	case "enqueue":
+		name, rest, _ := strings.Cut(rest, "/")
+		s.handlePublish(w, r, name, destination(rest, r.URL))
+	case "batch":
+		s.handleBatch(w, r)
+	case "messages":
+		s.handleMessages(w, r, rest)
+	case "events":
+		s.handleEvents(w, r)
+	case "schedules":
+		s.handleSchedules(w, r, rest)
+	case "queues":
+		s.handleQueues(w, r, rest)
+	case "topics":
+		s.handleUrlGroups(w, r, rest)
+	case "dlq":
+		s.handleDlq(w, r, rest)
+	case "keys":
+		s.handleKeys(w, r, false)
+	case "rotate":
+		s.handleKeys(w, r, true)
+	default:
+		writeError(w, http.StatusNotFound, "not found")
+	}
+}
+
+// destination restores the destination from the remaining request path,
+// including the query which belongs to the destination url.
+func destination(rest string, u *url.URL) string {
+	for _, scheme := range []string{"http:/", "https:/"} {
+		if strings.HasPrefix(rest, scheme) && !strings.HasPrefix(rest, scheme+"/") {
+			rest = scheme + "/" + strings.TrimPrefix(rest, scheme)
+		}
+	}
+	if u.RawQuery != "" {
+		rest = rest + "?" + u.RawQuery
+	}
+	return rest
+}
+
+func (s *Server) notify() {
+	select {
+	case s.wake <- struct{}{}:
+	default:
+	}
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(v)
+}
+
+func writeError(w http.ResponseWriter, status int, format string, args ...any) {
+	writeJSON(w, status, map[string]string{"error": fmt.Sprintf(format, args...)})
+}
+
+func randomId(prefix string) string {
+	b := make([]byte, 16)
+	_, _ = rand.Read(b)
+	return prefix + hex.EncodeToString(b)
+}
@@ -0,0 +1,362 @@
+package dev
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/upstash/qstash-go"
+)
+
+type delivery struct {
+	path   string
+	query  string
+	header http.Header
+	body   string
+	err    error
+}
+
+type consumer struct {
+	mu         sync.Mutex
+	deliveries []delivery
+	status     int
+}
+
+func (c *consumer) handler(receiver *qstash.Receiver, url string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		err := receiver.Verify(qstash.VerifyOptions{
+			Signature: r.Header.Get("Upstash-Signature"),
+			Body:      string(body),
+			Url:       url,
+		})
+		c.mu.Lock()
+		defer c.mu.Unlock()
+		c.deliveries = append(c.deliveries, delivery{
+			path:   r.URL.Path,
+			query:  r.URL.RawQuery,
+			header: r.Header.Clone(),
+			body:   string(body),
+			err:    err,
+		})
+		if c.status != 0 {
+			w.WriteHeader(c.status)
+		}
+	}
+}
+
+func (c *consumer) received() []delivery {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return append([]delivery(nil), c.deliveries...)
+}
+
+func startServer(t *testing.T, options Options) *Server {
+	if options.RetryBackoff == nil {
+		options.RetryBackoff = func(int) time.Duration { return 10 * time.Millisecond }
+	}
+	server := New(options)
+	assert.NoError(t, server.Start())
+	t.Cleanup(func() {
+		_ = server.Close()
+	})
+	return server
+}
+
+func TestPublishIsDeliveredAndVerified(t *testing.T) {
+	c := &consumer{}
+	server := startServer(t, Options{})
+	target := httptest.NewServer(nil)
+	defer target.Close()
+	target.Config.Handler = c.handler(server.Receiver(), target.URL+"/hook")
+
+	client := server.Client()
+	res, err := client.Publish(qstash.PublishOptions{
+		Url:         target.URL + "/hook",
+		Body:        "test-body",
+		ContentType: "text/plain",
+		Headers: map[string]string{
+			"test-header": "test-value",
+		},
+	})
+	assert.NoError(t, err)
+	assert.NotEmpty(t, res.MessageId)
+
+	assert.Eventually(t, func() bool {
+		return len(c.received()) == 1
+	}, 5*time.Second, 10*time.Millisecond)
+
+	d := c.received()[0]
+	assert.NoError(t, d.err)
+	assert.Equal(t, "/hook", d.path)
+	assert.Equal(t, "test-body", d.body)
+	assert.Equal(t, "test-value", d.header.Get("Test-Header"))
+	assert.Equal(t, "text/plain", d.header.Get("Content-Type"))
+	assert.Equal(t, res.MessageId, d.header.Get("Upstash-Message-Id"))
+	assert.Equal(t, "0", d.header.Get("Upstash-Retried"))
+
+	assert.Eventually(t, func() bool {
+		events, _, err := client.Events().List(qstash.ListEventsOptions{
+			Filter: qstash.EventFilter{MessageId: res.MessageId, State: qstash.Delivered},
+		})
+		return err == nil && len(events) == 1
+	}, 5*time.Second, 10*time.Millisecond)
+}
+
+func TestForward(t *testing.T) {
+	c := &consumer{}
+	target := httptest.NewServer(nil)
+	defer target.Close()
+	server := startServer(t, Options{Forward: target.URL + "/base"})
+	target.Config.Handler = c.handler(server.Receiver(), "https://example.com/hook?a=b")
+
+	_, err := server.Client().PublishJSON(qstash.PublishJSONOptions{
+		Url:  "https://example.com/hook?a=b",
+		Body: map[string]any{"hello": "world"},
+	})
+	assert.NoError(t, err)
+
+	assert.Eventually(t, func() bool {
+		return len(c.received()) == 1
+	}, 5*time.Second, 10*time.Millisecond)
+
+	d := c.received()[0]
+	assert.NoError(t, d.err)
+	assert.Equal(t, "/base/hook", d.path)
+	assert.Equal(t, "a=b", d.query)
+	assert.Equal(t, `{"hello":"world"}`, d.body)
+}
+
+func TestRetriesDlqAndFailureCallback(t *testing.T) {
+	failing := &consumer{status: http.StatusInternalServerError}
+	callback := &consumer{}
+	server := startServer(t, Options{})
+	target := httptest.NewServer(failing.handler(server.Receiver(), ""))
+	defer target.Close()
+	callbackTarget := httptest.NewServer(callback.handler(server.Receiver(), ""))
+	defer callbackTarget.Close()
+
+	client := server.Client()
+	res, err := client.Publish(qstash.PublishOptions{
+		Url:             target.URL,
+		Body:            "test-body",
+		Retries:         qstash.RetryCount(2),
+		FailureCallback: callbackTarget.URL,
+	})
+	assert.NoError(t, err)
+
+	assert.Eventually(t, func() bool {
+		return len(callback.received()) == 1
+	}, 5*time.Second, 10*time.Millisecond)
+	assert.Len(t, failing.received(), 3)
+	assert.Equal(t, "2", failing.received()[2].header.Get("Upstash-Retried"))
+
+	payload, err := qstash.ParseCallbackPayload([]byte(callback.received()[0].body))
+	assert.NoError(t, err)
+	assert.Equal(t, res.MessageId, payload.SourceMessageId)
+	assert.Equal(t, http.StatusInternalServerError, payload.Status)
+	assert.Equal(t, 2, payload.Retried)
+
+	messages, _, err := client.Dlq().List(qstash.ListDlqOptions{})
+	assert.NoError(t, err)
+	assert.Len(t, messages, 1)
+	assert.Equal(t, res.MessageId, messages[0].MessageId)
+	assert.Equal(t, http.StatusInternalServerError, messages[0].ResponseStatus)
+
+	count, err := client.Dlq().DeleteMany([]string{messages[0].DlqId})
+	assert.NoError(t, err)
+	assert.Equal(t, 1, count)
+}
+
+func TestUrlGroupFanOutThroughQueue(t *testing.T) {
+	first, second := &consumer{}, &consumer{}
+	server := startServer(t, Options{})
+	firstTarget := httptest.NewServer(first.handler(server.Receiver(), ""))
+	defer firstTarget.Close()
+	secondTarget := httptest.NewServer(second.handler(server.Receiver(), ""))
+	defer secondTarget.Close()
+
+	client := server.Client()
+	err := client.UrlGroups().UpsertEndpoints("group", []qstash.Endpoint{
+		{Url: firstTarget.URL, Name: "first"},
+		{Url: secondTarget.URL, Name: "second"},
+	})
+	assert.NoError(t, err)
+
+	err = client.Queues().Upsert(qstash.Queue{Name: "queue", Parallelism: 1, IsPaused: true})
+	assert.NoError(t, err)
+
+	responses, err := client.UrlGroups().Enqueue(qstash.EnqueueUrlGroupOptions{
+		Queue:    "queue",
+		UrlGroup: "group",
+		Body:     "test-body",
+	})
+	assert.NoError(t, err)
+	assert.Len(t, responses, 2)
+
+	queue, err := client.Queues().Get("queue")
+	assert.NoError(t, err)
+	assert.Equal(t, int64(2), queue.Lag)
+
+	assert.NoError(t, client.Queues().Resume("queue"))
+	assert.Eventually(t, func() bool {
+		return len(first.received()) == 1 && len(second.received()) == 1
+	}, 5*time.Second, 10*time.Millisecond)
+	assert.Equal(t, "group", first.received()[0].header.Get("Upstash-Topic-Name"))
+	assert.Equal(t, "second", second.received()[0].header.Get("Upstash-Endpoint-Name"))
+	assert.Equal(t, "queue", second.received()[0].header.Get("Upstash-Queue-Name"))
+}
+
+func TestCancelAndRotate(t *testing.T) {
+	server := startServer(t, Options{})
+	client := server.Client()
+
+	res, err := client.Publish(qstash.PublishOptions{
+		Url:   "https://example.com",
+		Delay: "1h",
+	})
+	assert.NoError(t, err)
+
+	message, err := client.Messages().Get(res.MessageId)
+	assert.NoError(t, err)
+	assert.Equal(t, "https://example.com", message.Url)
+
+	cancelled, err := client.Messages().CancelAll()
+	assert.NoError(t, err)
+	assert.Equal(t, 1, cancelled)
+
+	_, err = client.Messages().Get(res.MessageId)
+	assert.Error(t, err)
+
+	keys, err := client.Keys().Get()
+	assert.NoError(t, err)
+	rotated, err := client.Keys().Rotate()
+	assert.NoError(t, err)
+	assert.Equal(t, keys.Next, rotated.Current)
+	assert.Equal(t, rotated, server.SigningKeys())
+}
+
+func TestUnauthorized(t *testing.T) {
+	server := startServer(t, Options{})
+
+	client := qstash.NewClientWith(qstash.Options{Url: server.URL(), Token: "wrong"})
+	_, err := client.Queues().List()
+	assert.ErrorContains(t, err, "Unauthorized")
+}
+
+func TestScheduleFires(t *testing.T) {
+	c := &consumer{}
+	server := startServer(t, Options{})
+	target := httptest.NewServer(c.handler(server.Receiver(), ""))
+	defer target.Close()
+
+	client := server.Client()
+	scheduleId, err := client.Schedules().Create(qstash.ScheduleOptions{
+		Destination: target.URL,
+		Cron:        "* * * * *",
+		Body:        "test-body",
+	})
+	assert.NoError(t, err)
+
+	schedule, err := client.Schedules().Get(scheduleId)
+	assert.NoError(t, err)
+	assert.Greater(t, schedule.NextScheduleTime, time.Now().UnixMilli())
+
+	// Bring the next firing forward instead of waiting for the next minute.
+	server.mu.Lock()
+	server.schedules[scheduleId].NextScheduleTime = time.Now().UnixMilli()
+	server.mu.Unlock()
+
+	assert.Eventually(t, func() bool {
+		return len(c.received()) == 1
+	}, 5*time.Second, 10*time.Millisecond)
+	assert.Equal(t, scheduleId, c.received()[0].header.Get("Upstash-Schedule-Id"))
+	assert.Equal(t, "test-body", c.received()[0].body)
+
+	assert.Eventually(t, func() bool {
+		schedule, err = client.Schedules().Get(scheduleId)
+		for _, state := range schedule.LastScheduleStates {
+			return err == nil && state == string(qstash.Delivered)
+		}
+		return false
+	}, 5*time.Second, 10*time.Millisecond)
+	assert.NotZero(t, schedule.LastScheduleTime)
+}
+
+func TestScheduleNotBefore(t *testing.T) {
+	c := &consumer{}
+	server := startServer(t, Options{})
+	target := httptest.NewServer(c.handler(server.Receiver(), ""))
+	defer target.Close()
+
+	client := server.Client()
+	notBefore := time.Now().Add(time.Hour).Truncate(time.Second)
+	scheduleId, err := client.Schedules().Create(qstash.ScheduleOptions{
+		Destination: target.URL,
+		Cron:        "* * * * *",
+		Body:        "test-body",
+		NotBefore:   strconv.FormatInt(notBefore.Unix(), 10),
+	})
+	assert.NoError(t, err)
+
+	server.mu.Lock()
+	server.schedules[scheduleId].NextScheduleTime = time.Now().UnixMilli()
+	server.mu.Unlock()
+
+	var schedule qstash.Schedule
+	assert.Eventually(t, func() bool {
+		schedule, err = client.Schedules().Get(scheduleId)
+		return err == nil && len(schedule.LastScheduleStates) == 1
+	}, 5*time.Second, 10*time.Millisecond)
+	for messageId := range schedule.LastScheduleStates {
+		message, err := client.Messages().Get(messageId)
+		assert.NoError(t, err)
+		assert.Equal(t, notBefore.UnixMilli(), message.NotBefore)
+	}
+	assert.Empty(t, c.received())
+}
+
+func TestWaitAndNotify(t *testing.T) {
+	c := &consumer{}
+	server := startServer(t, Options{})
+	target := httptest.NewServer(nil)
+	defer target.Close()
+	target.Config.Handler = c.handler(server.Receiver(), "")
+
+	notified, err := server.Notify("order-1", []byte("approved"))
+	assert.NoError(t, err)
+	assert.Empty(t, notified)
+
+	assert.NoError(t, server.Wait("order-1", time.Hour, func(payload []byte) qstash.PublishOptions {
+		return qstash.PublishOptions{
+			Url:     target.URL + "/notified",
+			Headers: map[string]string{"Run": "run-1"},
+			Body:    "state:" + string(payload),
+		}
+	}, qstash.PublishOptions{Url: target.URL + "/timeout"}))
+	assert.NoError(t, server.Wait("order-2", time.Second, func(payload []byte) qstash.PublishOptions {
+		return qstash.PublishOptions{Url: target.URL + "/notified"}
+	}, qstash.PublishOptions{Url: target.URL + "/timeout", Body: "timed out"}))
+
+	notified, err = server.Notify("order-1", []byte("approved"))
+	assert.NoError(t, err)
+	assert.Len(t, notified, 1)
+	assert.NotEmpty(t, notified[0])
+
+	assert.Eventually(t, func() bool { return len(c.received()) == 2 }, 5*time.Second, 10*time.Millisecond)
+	received := c.received()
+	assert.Equal(t, "/notified", received[0].path)
+	assert.Equal(t, "run-1", received[0].header.Get("Run"))
+	assert.Equal(t, "state:approved", received[0].body)
+	assert.Equal(t, "/timeout", received[1].path)
+	assert.Equal(t, "timed out", received[1].body)
+
+	notified, err = server.Notify("order-2", []byte("approved"))
+	assert.NoError(t, err)
+	assert.Empty(t, notified)
+}
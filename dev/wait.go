@@ -0,0 +1,93 @@
+package dev
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/upstash/qstash-go"
+)
+
+type waiter struct {
+	eventId  string
+	deadline time.Time
+	notified func(payload []byte) qstash.PublishOptions
+	timedOut qstash.PublishOptions
+}
+
+// Wait registers a waiter for an event, which is resumed when the event is notified with Notify.
+// The message returned by notified for the payload of the event is published then,
+// and timedOut is published instead if the event is not notified before the timeout.
+//
+// QStash does not support waiting for events yet, so the server implements it locally to test workflow.Context.WaitForEvent.
+func (s *Server) Wait(eventId string, timeout time.Duration, notified func(payload []byte) qstash.PublishOptions, timedOut qstash.PublishOptions) error {
+	if eventId == "" {
+		return fmt.Errorf("`eventId` must be provided")
+	}
+	if timeout <= 0 {
+		return fmt.Errorf("`timeout` must be positive")
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.waiters = append(s.waiters, &waiter{
+		eventId:  eventId,
+		deadline: time.Now().Add(timeout),
+		notified: notified,
+		timedOut: timedOut,
+	})
+	return nil
+}
+
+// Notify notifies an event with a payload, and publishes the messages of its waiters.
+// It returns the ids of the published messages, and none if no waiter was waiting for the event.
+func (s *Server) Notify(eventId string, payload []byte) (messageIds []string, err error) {
+	s.mu.Lock()
+	var notified []*waiter
+	remaining := s.waiters[:0]
+	for _, wt := range s.waiters {
+		if wt.eventId == eventId {
+			notified = append(notified, wt)
+		} else {
+			remaining = append(remaining, wt)
+		}
+	}
+	s.waiters = remaining
+	s.mu.Unlock()
+
+	client := s.Client()
+	var errs []error
+	for _, wt := range notified {
+		response, pErr := client.Publish(wt.notified(payload))
+		if pErr != nil {
+			errs = append(errs, pErr)
+			continue
+		}
+		messageIds = append(messageIds, response.MessageId)
+	}
+	return messageIds, errors.Join(errs...)
+}
+
+// expireWaiters publishes the timeout messages of the waiters whose deadline passed.
+func (s *Server) expireWaiters() {
+	now := time.Now()
+	s.mu.Lock()
+	var expired []*waiter
+	remaining := s.waiters[:0]
+	for _, wt := range s.waiters {
+		if !wt.deadline.After(now) {
+			expired = append(expired, wt)
+		} else {
+			remaining = append(remaining, wt)
+		}
+	}
+	s.waiters = remaining
+	s.mu.Unlock()
+
+	if len(expired) == 0 {
+		return
+	}
+	client := s.Client()
+	for _, wt := range expired {
+		_, _ = client.Publish(wt.timedOut)
+	}
+}
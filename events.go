@@ -1,6 +1,7 @@
 package qstash
 
 import (
+	"context"
 	"net/http"
 	"time"
 )
@@ -47,6 +48,37 @@ type Event struct {
 	ScheduleId string `json:"scheduleId,omitempty"`
 }
 
+// statePrecedence orders the states of a message, for the events that happened in the same millisecond.
+var statePrecedence = map[EventState]int{
+	Created:         1,
+	Active:          2,
+	Error:           3,
+	Retry:           4,
+	CancelRequested: 5,
+	Delivered:       6,
+	Failed:          6,
+	Canceled:        6,
+}
+
+// supersedes reports whether the event is more recent than an event of the same message with the given time and state.
+// The events in the same millisecond are ordered by their state, so that a final state is never replaced by an earlier one.
+func (e Event) supersedes(time int64, state EventState) bool {
+	if e.Time != time {
+		return e.Time > time
+	}
+	return statePrecedence[e.State] > statePrecedence[state]
+}
+
+// Timestamp returns the time of the event.
+func (e Event) Timestamp() time.Time {
+	return fromUnixMilli(e.Time)
+}
+
+// NextDelivery returns the next scheduled delivery time of the message, zero if there is none.
+func (e Event) NextDelivery() time.Time {
+	return fromUnixMilli(e.NextDeliveryTime)
+}
+
 type EventFilter struct {
 	// MessageId filters events by the ID of the message.
 	MessageId string
@@ -90,3 +122,62 @@ func (e *Events) List(options ListEventsOptions) ([]Event, string, error) {
 	}
 	return events.Events, events.Cursor, nil
 }
+
+// eventHistory is the latest event of a message and the latest event with an error, from events read in any order.
+type eventHistory struct {
+	latest      Event
+	latestError Event
+}
+
+func (h *eventHistory) apply(e Event) {
+	if e.supersedes(h.latest.Time, h.latest.State) {
+		h.latest = e
+	}
+	if e.Error != "" && (h.latestError.Error == "" || e.Time > h.latestError.Time) {
+		h.latestError = e
+	}
+}
+
+// listAll lists the events that match the filter from all the pages, and applies them to the histories of their messages.
+// The events of the other messages are ignored. It returns the time of the latest event, the FromDate of the filter if there is none.
+func (e *Events) listAll(ctx context.Context, filter EventFilter, histories map[string]*eventHistory) (latest time.Time, err error) {
+	latest = filter.FromDate
+	options := ListEventsOptions{Filter: filter}
+	for {
+		if err = ctx.Err(); err != nil {
+			return
+		}
+		var page []Event
+		var cursor string
+		if page, cursor, err = e.List(options); err != nil {
+			return
+		}
+		for _, event := range page {
+			if event.Timestamp().After(latest) {
+				latest = event.Timestamp()
+			}
+			if h, ok := histories[event.MessageId]; ok {
+				h.apply(event)
+			}
+		}
+		if cursor == "" || len(page) == 0 {
+			return latest, nil
+		}
+		options.Cursor = cursor
+	}
+}
+
+// latest returns the latest state of a message, and its latest error.
+func (e *Events) latest(messageId string) (state EventState, reason string, err error) {
+	events, _, err := e.List(ListEventsOptions{
+		Filter: EventFilter{MessageId: messageId},
+	})
+	if err != nil {
+		return
+	}
+	var history eventHistory
+	for _, event := range events {
+		history.apply(event)
+	}
+	return history.latest.State, history.latestError.Error, nil
+}
@@ -2,6 +2,8 @@ package qstash
 
 import (
 	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
 	"testing"
 	"time"
 )
@@ -33,3 +35,20 @@ func TestEvents(t *testing.T) {
 		return !subT.Failed()
 	}, time.Second*10, time.Millisecond*100)
 }
+
+func TestEventsLatest(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(`{"events": [
+			{"time": 2, "messageId": "msg_1", "state": "DELIVERED"},
+			{"time": 2, "messageId": "msg_1", "state": "ACTIVE"},
+			{"time": 1, "messageId": "msg_1", "state": "RETRY", "error": "503 Service Unavailable"}
+		]}`))
+	}))
+	defer server.Close()
+	client := NewClientWith(Options{Url: server.URL, Token: "token"})
+
+	state, reason, err := client.Events().latest("msg_1")
+	assert.NoError(t, err)
+	assert.Equal(t, Delivered, state)
+	assert.Equal(t, "503 Service Unavailable", reason)
+}
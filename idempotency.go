@@ -0,0 +1,316 @@
+package qstash
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// IdempotencyRecord is the response recorded for a processed message.
+type IdempotencyRecord struct {
+	Status  int         `json:"status"`
+	Header  http.Header `json:"header,omitempty"`
+	Body    []byte      `json:"body,omitempty"`
+	Expires time.Time   `json:"expires"`
+}
+
+func (r IdempotencyRecord) expired(now time.Time) bool {
+	return !r.Expires.IsZero() && !now.Before(r.Expires)
+}
+
+// IdempotencyStore records the responses of processed messages.
+type IdempotencyStore interface {
+	// Get returns the record of the key, and false if there is none or it is expired.
+	Get(ctx context.Context, key string) (IdempotencyRecord, bool, error)
+	// Put records the response of the key.
+	Put(ctx context.Context, key string, record IdempotencyRecord) error
+}
+
+// idempotencySweepInterval is the minimum duration between two sweeps of the expired records of a store.
+const idempotencySweepInterval = time.Minute
+
+// MemoryIdempotencyStore keeps the records in memory, they are lost when the process exits.
+// Expired records are dropped when they are read, and by a sweep that runs at most once a minute.
+type MemoryIdempotencyStore struct {
+	mu        sync.Mutex
+	records   map[string]IdempotencyRecord
+	lastSweep time.Time
+}
+
+func NewMemoryIdempotencyStore() *MemoryIdempotencyStore {
+	return &MemoryIdempotencyStore{records: map[string]IdempotencyRecord{}, lastSweep: time.Now()}
+}
+
+func (s *MemoryIdempotencyStore) Get(_ context.Context, key string) (IdempotencyRecord, bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	record, ok := s.records[key]
+	if ok && record.expired(time.Now()) {
+		delete(s.records, key)
+		return IdempotencyRecord{}, false, nil
+	}
+	return record, ok, nil
+}
+
+func (s *MemoryIdempotencyStore) Put(_ context.Context, key string, record IdempotencyRecord) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if now := time.Now(); now.Sub(s.lastSweep) >= idempotencySweepInterval {
+		s.lastSweep = now
+		for k, r := range s.records {
+			if r.expired(now) {
+				delete(s.records, k)
+			}
+		}
+	}
+	s.records[key] = record
+	return nil
+}
+
+// FileIdempotencyStore keeps every record in a JSON file of a directory, so that they survive restarts.
+// Expired records are deleted when they are read, and by a sweep that runs at most once a minute.
+type FileIdempotencyStore struct {
+	dir string
+	// mu orders the writes and the sweeps, so that a sweep never deletes a record that was just written.
+	mu        sync.Mutex
+	lastSweep time.Time
+}
+
+func NewFileIdempotencyStore(dir string) (*FileIdempotencyStore, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+	return &FileIdempotencyStore{dir: dir, lastSweep: time.Now()}, nil
+}
+
+func (s *FileIdempotencyStore) path(key string) string {
+	return filepath.Join(s.dir, base64.RawURLEncoding.EncodeToString([]byte(key))+".json")
+}
+
+func (s *FileIdempotencyStore) Get(_ context.Context, key string) (record IdempotencyRecord, ok bool, err error) {
+	data, err := os.ReadFile(s.path(key))
+	if errors.Is(err, os.ErrNotExist) {
+		return record, false, nil
+	}
+	if err != nil {
+		return
+	}
+	if err = json.Unmarshal(data, &record); err != nil {
+		return
+	}
+	if record.expired(time.Now()) {
+		err = os.Remove(s.path(key))
+		if errors.Is(err, os.ErrNotExist) {
+			err = nil
+		}
+		return IdempotencyRecord{}, false, err
+	}
+	return record, true, nil
+}
+
+func (s *FileIdempotencyStore) Put(_ context.Context, key string, record IdempotencyRecord) error {
+	data, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+	// The record is written to a temporary file first, so that a crash never leaves a partial record.
+	tmp, err := os.CreateTemp(s.dir, ".record-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err = tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err = tmp.Close(); err != nil {
+		return err
+	}
+	s.mu.Lock()
+	now := time.Now()
+	sweep := now.Sub(s.lastSweep) >= idempotencySweepInterval
+	if sweep {
+		s.lastSweep = now
+	}
+	err = os.Rename(tmp.Name(), s.path(key))
+	s.mu.Unlock()
+	if sweep {
+		s.sweep(now)
+	}
+	return err
+}
+
+// sweep deletes the files of the expired records. Its errors are ignored, the records are swept again later.
+func (s *FileIdempotencyStore) sweep(now time.Time) {
+	entries, err := os.ReadDir(s.dir)
+	if err != nil {
+		return
+	}
+	for _, entry := range entries {
+		if entry.IsDir() || filepath.Ext(entry.Name()) != ".json" {
+			continue
+		}
+		path := filepath.Join(s.dir, entry.Name())
+		s.mu.Lock()
+		var record IdempotencyRecord
+		if data, err := os.ReadFile(path); err == nil && json.Unmarshal(data, &record) == nil && record.expired(now) {
+			_ = os.Remove(path)
+		}
+		s.mu.Unlock()
+	}
+}
+
+type IdempotencyOptions struct {
+	// Store records the responses, a MemoryIdempotencyStore by default.
+	Store IdempotencyStore
+	// TTL is how long a response is recorded, 24 hours by default.
+	TTL time.Duration
+	// Key returns the key the requests are deduplicated by, the `Upstash-Message-Id` header by default.
+	// Requests with an empty key are always handled.
+	Key func(r *http.Request) string
+	// OnError is called with the errors of the store, if it is set.
+	OnError func(err error)
+}
+
+// Idempotency makes sure a message is handled once although QStash delivers it at least once.
+//
+// The successful responses of the handler are recorded by message id, and returned as is when a message is delivered again.
+// Failed responses are not recorded, so that the message is handled again when QStash retries it.
+// Concurrent deliveries of the same message wait for each other, so that the handler runs once.
+type Idempotency struct {
+	options IdempotencyOptions
+	mu      sync.Mutex
+	locks   map[string]*idempotencyLock
+}
+
+type idempotencyLock struct {
+	mu   sync.Mutex
+	refs int
+}
+
+func NewIdempotency(options IdempotencyOptions) *Idempotency {
+	if options.Store == nil {
+		options.Store = NewMemoryIdempotencyStore()
+	}
+	if options.TTL <= 0 {
+		options.TTL = 24 * time.Hour
+	}
+	if options.Key == nil {
+		options.Key = func(r *http.Request) string {
+			return r.Header.Get(upstashMessageIdHeader)
+		}
+	}
+	return &Idempotency{
+		options: options,
+		locks:   map[string]*idempotencyLock{},
+	}
+}
+
+// lock locks the key, and returns the function to unlock it.
+func (i *Idempotency) lock(key string) func() {
+	i.mu.Lock()
+	l, ok := i.locks[key]
+	if !ok {
+		l = &idempotencyLock{}
+		i.locks[key] = l
+	}
+	l.refs++
+	i.mu.Unlock()
+
+	l.mu.Lock()
+	return func() {
+		l.mu.Unlock()
+		i.mu.Lock()
+		defer i.mu.Unlock()
+		if l.refs--; l.refs == 0 {
+			delete(i.locks, key)
+		}
+	}
+}
+
+func (i *Idempotency) onError(err error) {
+	if i.options.OnError != nil {
+		i.options.OnError(err)
+	}
+}
+
+// Handler wraps an HTTP handler, returning the recorded response of the messages that were already handled.
+func (i *Idempotency) Handler(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		key := i.options.Key(r)
+		if key == "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+		unlock := i.lock(key)
+		defer unlock()
+
+		record, ok, err := i.options.Store.Get(r.Context(), key)
+		if err != nil {
+			// The message may have been handled already, QStash retries it later.
+			i.onError(err)
+			http.Error(w, "failed to read idempotency record", http.StatusInternalServerError)
+			return
+		}
+		if ok {
+			writeRecord(w, record)
+			return
+		}
+
+		recorder := &responseRecorder{header: http.Header{}}
+		next.ServeHTTP(recorder, r)
+		record = recorder.record()
+		if record.Status >= http.StatusOK && record.Status < http.StatusMultipleChoices {
+			record.Expires = time.Now().Add(i.options.TTL)
+			if err = i.options.Store.Put(r.Context(), key, record); err != nil {
+				i.onError(err)
+			}
+		}
+		writeRecord(w, record)
+	})
+}
+
+func writeRecord(w http.ResponseWriter, record IdempotencyRecord) {
+	for k, v := range record.Header {
+		w.Header()[k] = v
+	}
+	w.WriteHeader(record.Status)
+	_, _ = w.Write(record.Body)
+}
+
+// responseRecorder buffers the response of a handler.
+type responseRecorder struct {
+	header http.Header
+	status int
+	body   bytes.Buffer
+}
+
+func (r *responseRecorder) Header() http.Header {
+	return r.header
+}
+
+func (r *responseRecorder) WriteHeader(status int) {
+	if r.status == 0 {
+		r.status = status
+	}
+}
+
+func (r *responseRecorder) Write(b []byte) (int, error) {
+	r.WriteHeader(http.StatusOK)
+	return r.body.Write(b)
+}
+
+func (r *responseRecorder) record() IdempotencyRecord {
+	status := r.status
+	if status == 0 {
+		status = http.StatusOK
+	}
+	return IdempotencyRecord{Status: status, Header: r.header, Body: r.body.Bytes()}
+}
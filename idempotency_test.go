@@ -0,0 +1,126 @@
+package qstash
+
+import (
+	"context"
+	"fmt"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestIdempotency(t *testing.T) {
+	for name, store := range map[string]func() IdempotencyStore{
+		"memory": func() IdempotencyStore { return NewMemoryIdempotencyStore() },
+		"file": func() IdempotencyStore {
+			store, err := NewFileIdempotencyStore(t.TempDir())
+			assert.NoError(t, err)
+			return store
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			var calls atomic.Int32
+			idempotency := NewIdempotency(IdempotencyOptions{Store: store()})
+			handler := idempotency.Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				n := calls.Add(1)
+				time.Sleep(10 * time.Millisecond)
+				if r.Header.Get("Fail") != "" {
+					http.Error(w, "failed", http.StatusInternalServerError)
+					return
+				}
+				w.Header().Set("X-Call", fmt.Sprint(n))
+				w.WriteHeader(http.StatusCreated)
+				_, _ = w.Write([]byte("done"))
+			}))
+			send := func(messageId string, fail bool) *httptest.ResponseRecorder {
+				r := httptest.NewRequest(http.MethodPost, "/", nil)
+				r.Header.Set("Upstash-Message-Id", messageId)
+				if fail {
+					r.Header.Set("Fail", "true")
+				}
+				w := httptest.NewRecorder()
+				handler.ServeHTTP(w, r)
+				return w
+			}
+
+			// Concurrent deliveries of a message are handled once.
+			var wg sync.WaitGroup
+			responses := make([]*httptest.ResponseRecorder, 5)
+			for i := range responses {
+				wg.Add(1)
+				go func(i int) {
+					defer wg.Done()
+					responses[i] = send("msg_1", false)
+				}(i)
+			}
+			wg.Wait()
+			assert.Equal(t, int32(1), calls.Load())
+			for _, w := range responses {
+				assert.Equal(t, http.StatusCreated, w.Code)
+				assert.Equal(t, "1", w.Header().Get("X-Call"))
+				assert.Equal(t, "done", w.Body.String())
+			}
+
+			// Failed responses are not recorded.
+			assert.Equal(t, http.StatusInternalServerError, send("msg_2", true).Code)
+			assert.Equal(t, http.StatusCreated, send("msg_2", false).Code)
+			assert.Equal(t, int32(3), calls.Load())
+			assert.Equal(t, "3", send("msg_2", false).Header().Get("X-Call"))
+			assert.Equal(t, int32(3), calls.Load())
+		})
+	}
+}
+
+func TestIdempotencyStoreExpiry(t *testing.T) {
+	fileStore, err := NewFileIdempotencyStore(t.TempDir())
+	assert.NoError(t, err)
+	for _, store := range []IdempotencyStore{NewMemoryIdempotencyStore(), fileStore} {
+		ctx := context.Background()
+		assert.NoError(t, store.Put(ctx, "expired", IdempotencyRecord{Status: 200, Expires: time.Now().Add(-time.Second)}))
+		assert.NoError(t, store.Put(ctx, "msg/1", IdempotencyRecord{Status: 200, Body: []byte("ok"), Expires: time.Now().Add(time.Hour)}))
+
+		_, ok, err := store.Get(ctx, "expired")
+		assert.NoError(t, err)
+		assert.False(t, ok)
+
+		record, ok, err := store.Get(ctx, "msg/1")
+		assert.NoError(t, err)
+		assert.True(t, ok)
+		assert.Equal(t, "ok", string(record.Body))
+
+		_, ok, err = store.Get(ctx, "unknown")
+		assert.NoError(t, err)
+		assert.False(t, ok)
+	}
+}
+
+func TestMemoryIdempotencyStoreSweep(t *testing.T) {
+	store := NewMemoryIdempotencyStore()
+	ctx := context.Background()
+	assert.NoError(t, store.Put(ctx, "expired", IdempotencyRecord{Status: 200, Expires: time.Now().Add(-time.Second)}))
+	assert.NoError(t, store.Put(ctx, "other", IdempotencyRecord{Status: 200}))
+	assert.Len(t, store.records, 2)
+
+	store.lastSweep = time.Now().Add(-idempotencySweepInterval)
+	assert.NoError(t, store.Put(ctx, "new", IdempotencyRecord{Status: 200}))
+	assert.Len(t, store.records, 2)
+	assert.NotContains(t, store.records, "expired")
+}
+
+func TestFileIdempotencyStoreSweep(t *testing.T) {
+	store, err := NewFileIdempotencyStore(t.TempDir())
+	assert.NoError(t, err)
+	ctx := context.Background()
+	assert.NoError(t, store.Put(ctx, "expired", IdempotencyRecord{Status: 200, Expires: time.Now().Add(-time.Second)}))
+	assert.NoError(t, store.Put(ctx, "other", IdempotencyRecord{Status: 200}))
+	assert.FileExists(t, store.path("expired"))
+
+	store.lastSweep = time.Now().Add(-idempotencySweepInterval)
+	assert.NoError(t, store.Put(ctx, "new", IdempotencyRecord{Status: 200}))
+	assert.NoFileExists(t, store.path("expired"))
+	assert.FileExists(t, store.path("other"))
+	assert.FileExists(t, store.path("new"))
+}
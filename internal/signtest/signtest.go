@@ -0,0 +1,27 @@
+// Package signtest signs requests like QStash, for the tests of the adapters.
+package signtest
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+const Key = "test-key"
+
+// Sign returns the signature of body delivered to url, signed with Key.
+func Sign(url string, body string) (string, error) {
+	hash := sha256.Sum256([]byte(body))
+	now := time.Now().Unix()
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
+		"iss":  "Upstash",
+		"sub":  url,
+		"iat":  now,
+		"nbf":  now,
+		"exp":  now + 300,
+		"body": base64.URLEncoding.EncodeToString(hash[:]),
+	})
+	return token.SignedString([]byte(Key))
+}
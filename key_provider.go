@@ -0,0 +1,135 @@
+package qstash
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// KeyProvider provides the signing keys a Receiver verifies the signatures with, instead of static keys.
+type KeyProvider interface {
+	// SigningKeys returns the signing keys to verify the signatures with.
+	SigningKeys() (SigningKeys, error)
+	// Refresh is called when a signature can not be verified, in case the keys were rotated.
+	// It returns the new keys, and whether they changed.
+	Refresh() (keys SigningKeys, changed bool, err error)
+}
+
+type KeysProviderOptions struct {
+	// RefreshInterval is how long the keys are cached before they are fetched again, 1 hour by default.
+	RefreshInterval time.Duration
+	// MinRefreshInterval is the minimum duration between two refreshes triggered by a failed verification, 30 seconds by default.
+	// It prevents invalid signatures from causing a request to QStash each, and is also waited for after a fetch fails.
+	MinRefreshInterval time.Duration
+}
+
+// KeysProvider is a KeyProvider that fetches the signing keys with the Keys API and caches them.
+// It is safe for concurrent use.
+type KeysProvider struct {
+	keys    *Keys
+	options KeysProviderOptions
+	now     func() time.Time
+
+	mu        sync.Mutex
+	cached    SigningKeys
+	fetchedAt time.Time
+	// attemptedAt is the time of the last fetch, successful or not, which throttles the next ones.
+	attemptedAt time.Time
+	// fetching is closed when the fetch in progress completes, it is nil if there is none.
+	fetching chan struct{}
+	// changed and err are the result of the last fetch.
+	changed bool
+	err     error
+}
+
+func NewKeysProvider(client *Client, options KeysProviderOptions) *KeysProvider {
+	if options.RefreshInterval <= 0 {
+		options.RefreshInterval = time.Hour
+	}
+	if options.MinRefreshInterval <= 0 {
+		options.MinRefreshInterval = 30 * time.Second
+	}
+	return &KeysProvider{
+		keys:    client.Keys(),
+		options: options,
+		now:     time.Now,
+	}
+}
+
+// SigningKeys returns the cached signing keys, fetching them if they are older than the refresh interval.
+// The cached keys are returned if they can not be fetched again, and the next fetch is attempted after the minimum refresh interval.
+func (p *KeysProvider) SigningKeys() (SigningKeys, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	now := p.now()
+	throttled := !p.attemptedAt.IsZero() && now.Sub(p.attemptedAt) < p.options.MinRefreshInterval
+	switch {
+	case p.fetchedAt.IsZero() && throttled && p.err != nil:
+		return p.cached, p.err
+	case !p.fetchedAt.IsZero() && (now.Sub(p.fetchedAt) < p.options.RefreshInterval || throttled || p.fetching != nil):
+		return p.cached, nil
+	}
+	p.fetch()
+	if p.err != nil && !p.fetchedAt.IsZero() {
+		return p.cached, nil
+	}
+	return p.cached, p.err
+}
+
+// Refresh fetches the signing keys, unless they were fetched, or failed to be, less than the minimum refresh interval ago.
+func (p *KeysProvider) Refresh() (keys SigningKeys, changed bool, err error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if !p.attemptedAt.IsZero() && p.now().Sub(p.attemptedAt) < p.options.MinRefreshInterval {
+		return p.cached, false, nil
+	}
+	p.fetch()
+	return p.cached, p.changed, p.err
+}
+
+// fetch fetches the signing keys, or waits for the fetch in progress if there is one.
+// It is called with the lock held, and releases it during the request so that the cached keys stay available.
+func (p *KeysProvider) fetch() {
+	if p.fetching != nil {
+		done := p.fetching
+		p.mu.Unlock()
+		<-done
+		p.mu.Lock()
+		return
+	}
+	done := make(chan struct{})
+	p.fetching = done
+	p.attemptedAt = p.now()
+	p.mu.Unlock()
+	keys, err := p.keys.Get()
+	p.mu.Lock()
+	p.fetching = nil
+	close(done)
+	if err != nil {
+		p.changed, p.err = false, fmt.Errorf("failed to fetch signing keys: %w", err)
+		return
+	}
+	p.changed, p.err = keys != p.cached, nil
+	p.cached = keys
+	p.fetchedAt = p.now()
+}
+
+// verifyWithProvider verifies a signature with the keys of the provider, refreshing them once if the verification fails.
+// The signature is verified again whenever the keys of the provider differ from the ones it failed with,
+// including when they were refreshed by a concurrent verification.
+func verifyWithProvider(provider KeyProvider, opts VerifyOptions) error {
+	keys, err := provider.SigningKeys()
+	if err != nil {
+		return err
+	}
+	err = verifyWithKeys(keys, opts)
+	if !errors.Is(err, ErrInvalidSignature) {
+		return err
+	}
+	refreshed, _, rErr := provider.Refresh()
+	if rErr != nil || refreshed == keys {
+		return err
+	}
+	return verifyWithKeys(refreshed, opts)
+}
@@ -0,0 +1,139 @@
+package qstash
+
+import (
+	"encoding/json"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestKeysProvider(t *testing.T) {
+	var mu sync.Mutex
+	keys := SigningKeys{Current: "key-1", Next: "key-2"}
+	fetches := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		fetches++
+		_ = json.NewEncoder(w).Encode(keys)
+	}))
+	defer server.Close()
+	rotate := func() {
+		mu.Lock()
+		defer mu.Unlock()
+		keys = SigningKeys{Current: keys.Next, Next: "key-3"}
+	}
+
+	now := time.Now()
+	provider := NewKeysProvider(NewClientWith(Options{Url: server.URL, Token: "token"}), KeysProviderOptions{
+		RefreshInterval:    time.Hour,
+		MinRefreshInterval: time.Minute,
+	})
+	provider.now = func() time.Time { return now }
+	receiver := NewReceiverWithKeyProvider(provider)
+
+	verify := func(key string) error {
+		signature, err := sign("body", key)
+		assert.NoError(t, err)
+		return receiver.Verify(VerifyOptions{Signature: signature, Body: "body"})
+	}
+
+	assert.NoError(t, verify("key-1"))
+	assert.NoError(t, verify("key-2"))
+	assert.Equal(t, 1, fetches)
+
+	// A failed verification refreshes the keys, at most once per minimum refresh interval.
+	rotate()
+	now = now.Add(2 * time.Minute)
+	assert.NoError(t, verify("key-3"))
+	assert.Equal(t, 2, fetches)
+	assert.ErrorIs(t, verify("unknown"), ErrInvalidSignature)
+	assert.ErrorIs(t, verify("unknown"), ErrInvalidSignature)
+	assert.Equal(t, 2, fetches)
+
+	now = now.Add(2 * time.Minute)
+	assert.ErrorIs(t, verify("unknown"), ErrInvalidSignature)
+	assert.Equal(t, 3, fetches)
+
+	// The keys are fetched again once they are older than the refresh interval.
+	now = now.Add(time.Hour)
+	cached, err := provider.SigningKeys()
+	assert.NoError(t, err)
+	assert.Equal(t, SigningKeys{Current: "key-2", Next: "key-3"}, cached)
+	assert.Equal(t, 4, fetches)
+
+	// The cached keys are used when they can not be fetched.
+	server.Close()
+	now = now.Add(2 * time.Hour)
+	cached, err = provider.SigningKeys()
+	assert.NoError(t, err)
+	assert.Equal(t, "key-2", cached.Current)
+
+	// A failed fetch is not attempted again before the minimum refresh interval.
+	now = now.Add(30 * time.Second)
+	cached, err = provider.SigningKeys()
+	assert.NoError(t, err)
+	assert.Equal(t, "key-2", cached.Current)
+	assert.Equal(t, now.Add(-30*time.Second), provider.attemptedAt)
+}
+
+func TestKeysProviderConcurrentFetch(t *testing.T) {
+	release := make(chan struct{})
+	var mu sync.Mutex
+	fetches := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		fetches++
+		mu.Unlock()
+		<-release
+		_ = json.NewEncoder(w).Encode(SigningKeys{Current: "key-1", Next: "key-2"})
+	}))
+	defer server.Close()
+	provider := NewKeysProvider(NewClientWith(Options{Url: server.URL, Token: "token"}), KeysProviderOptions{})
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			keys, err := provider.SigningKeys()
+			assert.NoError(t, err)
+			assert.Equal(t, "key-1", keys.Current)
+		}()
+	}
+	time.Sleep(50 * time.Millisecond)
+	close(release)
+	wg.Wait()
+	assert.Equal(t, 1, fetches)
+}
+
+// rotatedKeyProvider returns stale keys first, and the rotated ones on Refresh without reporting a change,
+// as a KeysProvider does when the keys were refreshed by a concurrent verification.
+type rotatedKeyProvider struct {
+	stale, rotated SigningKeys
+}
+
+func (p rotatedKeyProvider) SigningKeys() (SigningKeys, error) {
+	return p.stale, nil
+}
+
+func (p rotatedKeyProvider) Refresh() (SigningKeys, bool, error) {
+	return p.rotated, false, nil
+}
+
+func TestVerifyWithRotatedKeys(t *testing.T) {
+	receiver := NewReceiverWithKeyProvider(rotatedKeyProvider{
+		stale:   SigningKeys{Current: "key-1", Next: "key-2"},
+		rotated: SigningKeys{Current: "key-2", Next: "key-3"},
+	})
+	signature, err := sign("body", "key-3")
+	assert.NoError(t, err)
+	assert.NoError(t, receiver.Verify(VerifyOptions{Signature: signature, Body: "body"}))
+
+	signature, err = sign("body", "unknown")
+	assert.NoError(t, err)
+	assert.ErrorIs(t, receiver.Verify(VerifyOptions{Signature: signature, Body: "body"}), ErrInvalidSignature)
+}
@@ -0,0 +1,270 @@
+package qstash
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/golang-jwt/jwt/v5"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// probeBody is the body of the requests sent to the probes of a key rotation.
+const probeBody = `{"type":"qstash-key-rotation-probe"}`
+
+// SecretSink stores the signing keys the receivers are configured with.
+type SecretSink interface {
+	WriteKeys(ctx context.Context, keys SigningKeys) error
+}
+
+// SecretSinkFunc is a SecretSink backed by a function.
+type SecretSinkFunc func(ctx context.Context, keys SigningKeys) error
+
+func (f SecretSinkFunc) WriteKeys(ctx context.Context, keys SigningKeys) error {
+	return f(ctx, keys)
+}
+
+// EnvFileSink writes the keys as QSTASH_CURRENT_SIGNING_KEY and QSTASH_NEXT_SIGNING_KEY to an env file,
+// keeping the other variables of the file.
+type EnvFileSink struct {
+	Path string
+}
+
+func (s EnvFileSink) WriteKeys(_ context.Context, keys SigningKeys) error {
+	data, err := os.ReadFile(s.Path)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	values := map[string]string{
+		currentSigningKeyEnvProperty: keys.Current,
+		nextSigningKeyEnvProperty:    keys.Next,
+	}
+	var lines []string
+	if len(data) > 0 {
+		lines = strings.Split(strings.TrimSuffix(string(data), "\n"), "\n")
+	}
+	for i, line := range lines {
+		name, _, _ := strings.Cut(strings.TrimPrefix(strings.TrimSpace(line), "export "), "=")
+		if value, ok := values[strings.TrimSpace(name)]; ok {
+			lines[i] = fmt.Sprintf("%s=%s", strings.TrimSpace(name), value)
+			delete(values, strings.TrimSpace(name))
+		}
+	}
+	for _, name := range []string{currentSigningKeyEnvProperty, nextSigningKeyEnvProperty} {
+		if value, ok := values[name]; ok {
+			lines = append(lines, fmt.Sprintf("%s=%s", name, value))
+		}
+	}
+	return writeFileAtomic(s.Path, []byte(strings.Join(lines, "\n")+"\n"))
+}
+
+// JSONFileSink writes the keys to a JSON file, in the format of SigningKeys.
+type JSONFileSink struct {
+	Path string
+}
+
+func (s JSONFileSink) WriteKeys(_ context.Context, keys SigningKeys) error {
+	data, err := json.MarshalIndent(keys, "", "  ")
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(s.Path, append(data, '\n'))
+}
+
+// writeFileAtomic replaces the content of a file, so that it is never read partially written.
+func writeFileAtomic(path string, data []byte) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+"-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err = tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err = tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+type KeyRotationOptions struct {
+	// Probes are the urls of the receivers, which are sent a POST request signed with the next signing key
+	// before the rotation. Every probe must respond with a 2xx status code for the rotation to happen.
+	Probes []string
+	// Sinks are written the new signing keys after the rotation.
+	Sinks []SecretSink
+	// Client is the HTTP client the probes are sent with, http.DefaultClient by default.
+	Client *http.Client
+	// ProbeTimeout is the timeout of a probe, 10 seconds by default.
+	ProbeTimeout time.Duration
+}
+
+type ProbeResult struct {
+	Url string
+	// Status is the status code of the response, 0 if the request failed.
+	Status int
+	Error  error
+}
+
+// Ok reports whether the receiver accepted the probe.
+func (r ProbeResult) Ok() bool {
+	return r.Error == nil && r.Status >= http.StatusOK && r.Status < http.StatusMultipleChoices
+}
+
+type ProbeError struct {
+	Failed []ProbeResult
+}
+
+func (e *ProbeError) Error() string {
+	urls := make([]string, len(e.Failed))
+	for i, r := range e.Failed {
+		urls[i] = r.Url
+	}
+	return fmt.Sprintf("receivers do not accept the next signing key: %s", strings.Join(urls, ", "))
+}
+
+type KeyRotationResult struct {
+	// Previous are the keys before the rotation.
+	Previous SigningKeys
+	// Keys are the keys after the rotation, zero if the keys were not rotated.
+	Keys   SigningKeys
+	Probes []ProbeResult
+}
+
+// KeyRotation rotates the signing keys once the receivers are known to accept the next signing key,
+// and distributes the new keys to the secret sinks.
+//
+// If a probe fails, the keys are not rotated. The rotation itself can not be undone, but the receivers
+// still configured with the previous keys keep working after it, since the previous next key becomes the current key.
+// So if a sink can not be written, the sinks written before it are rolled back to the previous keys,
+// which keeps the receivers consistent until the keys are written again with WriteKeys.
+type KeyRotation struct {
+	keys    *Keys
+	options KeyRotationOptions
+}
+
+func NewKeyRotation(client *Client, options KeyRotationOptions) *KeyRotation {
+	if options.Client == nil {
+		options.Client = http.DefaultClient
+	}
+	if options.ProbeTimeout <= 0 {
+		options.ProbeTimeout = 10 * time.Second
+	}
+	return &KeyRotation{
+		keys:    client.Keys(),
+		options: options,
+	}
+}
+
+// Probe sends a request signed with the next signing key to every probe, without rotating the keys.
+func (k *KeyRotation) Probe(ctx context.Context) (results []ProbeResult, err error) {
+	keys, err := k.keys.Get()
+	if err != nil {
+		return
+	}
+	return k.probe(ctx, keys.Next)
+}
+
+func (k *KeyRotation) probe(ctx context.Context, key string) (results []ProbeResult, err error) {
+	var failed []ProbeResult
+	for _, url := range k.options.Probes {
+		result := ProbeResult{Url: url}
+		result.Status, result.Error = k.send(ctx, url, key)
+		if !result.Ok() {
+			failed = append(failed, result)
+		}
+		results = append(results, result)
+	}
+	if len(failed) > 0 {
+		err = &ProbeError{Failed: failed}
+	}
+	return
+}
+
+func (k *KeyRotation) send(ctx context.Context, url string, key string) (int, error) {
+	ctx, cancel := context.WithTimeout(ctx, k.options.ProbeTimeout)
+	defer cancel()
+	signature, err := signWithKey(key, url, []byte(probeBody))
+	if err != nil {
+		return 0, err
+	}
+	request, err := http.NewRequestWithContext(ctx, http.MethodPost, url, strings.NewReader(probeBody))
+	if err != nil {
+		return 0, err
+	}
+	request.Header.Set("Content-Type", "application/json")
+	request.Header.Set(upstashSignatureHeader, signature)
+	response, err := k.options.Client.Do(request)
+	if err != nil {
+		return 0, err
+	}
+	defer response.Body.Close()
+	return response.StatusCode, nil
+}
+
+// Run probes the receivers, rotates the signing keys and writes the new keys to the sinks.
+func (k *KeyRotation) Run(ctx context.Context) (result KeyRotationResult, err error) {
+	result.Previous, err = k.keys.Get()
+	if err != nil {
+		return
+	}
+	result.Probes, err = k.probe(ctx, result.Previous.Next)
+	if err != nil {
+		return
+	}
+	result.Keys, err = k.keys.Rotate()
+	if err != nil {
+		return
+	}
+	err = k.write(ctx, result.Keys, result.Previous)
+	return
+}
+
+// WriteKeys writes the keys to the sinks, to retry after a sink failed.
+func (k *KeyRotation) WriteKeys(ctx context.Context, keys SigningKeys) error {
+	for i, sink := range k.options.Sinks {
+		if err := sink.WriteKeys(ctx, keys); err != nil {
+			return fmt.Errorf("failed to write signing keys to sink %d: %w", i, err)
+		}
+	}
+	return nil
+}
+
+func (k *KeyRotation) write(ctx context.Context, keys SigningKeys, previous SigningKeys) error {
+	for i, sink := range k.options.Sinks {
+		err := sink.WriteKeys(ctx, keys)
+		if err == nil {
+			continue
+		}
+		err = fmt.Errorf("failed to write signing keys to sink %d: %w", i, err)
+		for _, written := range k.options.Sinks[:i] {
+			if rErr := written.WriteKeys(ctx, previous); rErr != nil {
+				err = errors.Join(err, fmt.Errorf("failed to roll back signing keys: %w", rErr))
+			}
+		}
+		return err
+	}
+	return nil
+}
+
+// signWithKey signs a body delivered to url, in the same format as QStash.
+func signWithKey(key string, url string, body []byte) (string, error) {
+	hash := sha256.Sum256(body)
+	now := time.Now()
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
+		"iss":  "Upstash",
+		"sub":  url,
+		"iat":  now.Unix(),
+		"nbf":  now.Unix(),
+		"exp":  now.Add(5 * time.Minute).Unix(),
+		"body": base64.URLEncoding.EncodeToString(hash[:]),
+	})
+	return token.SignedString([]byte(key))
+}
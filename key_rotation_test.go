@@ -0,0 +1,117 @@
+package qstash
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func keysServer(keys *SigningKeys, rotations *int) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/v2/rotate" {
+			*rotations++
+			*keys = SigningKeys{Current: keys.Next, Next: fmt.Sprintf("key-%d", *rotations+2)}
+		}
+		_ = json.NewEncoder(w).Encode(keys)
+	}))
+}
+
+func TestKeyRotation(t *testing.T) {
+	keys := SigningKeys{Current: "key-1", Next: "key-2"}
+	rotations := 0
+	api := keysServer(&keys, &rotations)
+	defer api.Close()
+	client := NewClientWith(Options{Url: api.URL, Token: "token"})
+
+	var receiverUrl string
+	accepting := NewReceiver("key-1", "key-2")
+	rejecting := NewReceiver("key-1", "key-1")
+	receivers := map[string]*Receiver{"/accepting": accepting, "/rejecting": rejecting}
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		opts := VerifyRequestOptions{BaseUrl: receiverUrl}
+		receivers[r.URL.Path].Middleware(opts)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})).ServeHTTP(w, r)
+	}))
+	defer receiver.Close()
+	receiverUrl = receiver.URL
+
+	dir := t.TempDir()
+	envFile := filepath.Join(dir, ".env")
+	assert.NoError(t, os.WriteFile(envFile, []byte("PORT=8080\nQSTASH_CURRENT_SIGNING_KEY=key-1\nQSTASH_NEXT_SIGNING_KEY=key-2\n"), 0o600))
+	jsonFile := filepath.Join(dir, "keys.json")
+	var written []SigningKeys
+
+	sinks := []SecretSink{
+		EnvFileSink{Path: envFile},
+		JSONFileSink{Path: jsonFile},
+		SecretSinkFunc(func(ctx context.Context, keys SigningKeys) error {
+			written = append(written, keys)
+			return nil
+		}),
+	}
+
+	// A receiver that does not accept the next key prevents the rotation.
+	rotation := NewKeyRotation(client, KeyRotationOptions{
+		Probes: []string{receiver.URL + "/accepting", receiver.URL + "/rejecting"},
+		Sinks:  sinks,
+	})
+	result, err := rotation.Run(context.Background())
+	var probeErr *ProbeError
+	assert.ErrorAs(t, err, &probeErr)
+	assert.Len(t, probeErr.Failed, 1)
+	assert.Equal(t, http.StatusUnauthorized, probeErr.Failed[0].Status)
+	assert.Len(t, result.Probes, 2)
+	assert.Equal(t, 0, rotations)
+
+	rotation = NewKeyRotation(client, KeyRotationOptions{
+		Probes: []string{receiver.URL + "/accepting"},
+		Sinks:  sinks,
+	})
+	result, err = rotation.Run(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, 1, rotations)
+	assert.Equal(t, SigningKeys{Current: "key-1", Next: "key-2"}, result.Previous)
+	assert.Equal(t, SigningKeys{Current: "key-2", Next: "key-3"}, result.Keys)
+
+	env, err := os.ReadFile(envFile)
+	assert.NoError(t, err)
+	assert.Equal(t, "PORT=8080\nQSTASH_CURRENT_SIGNING_KEY=key-2\nQSTASH_NEXT_SIGNING_KEY=key-3\n", string(env))
+	data, err := os.ReadFile(jsonFile)
+	assert.NoError(t, err)
+	var fromJson SigningKeys
+	assert.NoError(t, json.Unmarshal(data, &fromJson))
+	assert.Equal(t, result.Keys, fromJson)
+	assert.Equal(t, []SigningKeys{result.Keys}, written)
+}
+
+func TestKeyRotationRollback(t *testing.T) {
+	keys := SigningKeys{Current: "key-1", Next: "key-2"}
+	rotations := 0
+	api := keysServer(&keys, &rotations)
+	defer api.Close()
+
+	jsonFile := filepath.Join(t.TempDir(), "keys.json")
+	rotation := NewKeyRotation(NewClientWith(Options{Url: api.URL, Token: "token"}), KeyRotationOptions{
+		Sinks: []SecretSink{
+			JSONFileSink{Path: jsonFile},
+			SecretSinkFunc(func(ctx context.Context, keys SigningKeys) error {
+				return fmt.Errorf("vault is sealed")
+			}),
+		},
+	})
+	result, err := rotation.Run(context.Background())
+	assert.ErrorContains(t, err, "vault is sealed")
+	assert.Equal(t, 1, rotations)
+
+	// The sinks written before the failure are rolled back to the previous keys.
+	data, err := os.ReadFile(jsonFile)
+	assert.NoError(t, err)
+	var fromJson SigningKeys
+	assert.NoError(t, json.Unmarshal(data, &fromJson))
+	assert.Equal(t, result.Previous, fromJson)
+}
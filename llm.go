@@ -0,0 +1,312 @@
+package qstash
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+const (
+	openAIBaseUrl    = "https://api.openai.com"
+	anthropicBaseUrl = "https://api.anthropic.com"
+	anthropicVersion = "2023-06-01"
+	// anthropicMaxTokens is the default maximum number of tokens of a completion, which Anthropic requires.
+	anthropicMaxTokens = 1024
+)
+
+type LlmOptions struct {
+	// Provider is the provider of the llm api, UpstashProvider by default.
+	Provider ApiProvider
+	// BaseUrl is the base url of the api, required for CustomProvider, and the url of the provider by default otherwise.
+	BaseUrl string
+	// ApiKey is the api key of the provider, forwarded to it in the header it expects.
+	// It is required for OpenAIProvider and AnthropicProvider, and not used by UpstashProvider.
+	ApiKey string
+}
+
+// ToLLM returns a destination that sends chat completion requests to the llm api of a provider.
+// QStash calls the apis of providers other than Upstash by their url, forwarding the api key to them.
+func ToLLM(options LlmOptions) Destination {
+	provider := options.Provider
+	if provider == "" || provider == UpstashProvider {
+		return ToAPI("llm", UpstashProvider)
+	}
+	d := llmDestination(options)
+	if d.err == nil && options.ApiKey == "" && provider != CustomProvider {
+		d.err = fmt.Errorf("`ApiKey` must be provided for the %s provider", provider)
+	}
+	return d
+}
+
+// llmDestination returns the destination of the llm api of a provider other than Upstash, with its api key if it is set.
+func llmDestination(options LlmOptions) Destination {
+	provider := options.Provider
+	d := Destination{kind: DestinationApi, value: "llm", provider: provider, header: http.Header{}}
+	base := strings.TrimSuffix(options.BaseUrl, "/")
+	switch provider {
+	case OpenAIProvider, CustomProvider:
+		if base == "" && provider == OpenAIProvider {
+			base = openAIBaseUrl
+		}
+		d.url = chatCompletionsUrl(base)
+		if options.ApiKey != "" {
+			d.header.Set(fmt.Sprintf("%s-Authorization", upstashForwardHeader), "Bearer "+options.ApiKey)
+		}
+	case AnthropicProvider:
+		if base == "" {
+			base = anthropicBaseUrl
+		}
+		d.url = strings.TrimSuffix(base, "/v1/messages") + "/v1/messages"
+		if options.ApiKey != "" {
+			d.header.Set(fmt.Sprintf("%s-X-Api-Key", upstashForwardHeader), options.ApiKey)
+		}
+		d.header.Set(fmt.Sprintf("%s-Anthropic-Version", upstashForwardHeader), anthropicVersion)
+	default:
+		d.err = fmt.Errorf("unsupported api provider %q", provider)
+		return d
+	}
+	if base == "" {
+		d.err = fmt.Errorf("`BaseUrl` must be provided for the %s provider", provider)
+	} else {
+		d.err = ToURL(d.url).Err()
+	}
+	return d
+}
+
+// chatCompletionsUrl returns the chat completions endpoint of an OpenAI compatible api.
+func chatCompletionsUrl(base string) string {
+	switch {
+	case base == "" || strings.HasSuffix(base, "/chat/completions"):
+		return base
+	case strings.HasSuffix(base, "/v1"):
+		return base + "/chat/completions"
+	default:
+		return base + "/v1/chat/completions"
+	}
+}
+
+type ChatMessage struct {
+	// Role is the author of the message: system, user or assistant.
+	Role string `json:"role"`
+	// Content is the text of the message.
+	Content string `json:"content"`
+}
+
+// ChatCompletionRequest is a chat completion request in the OpenAI format.
+// It is converted to the format of Anthropic when it is sent to AnthropicProvider.
+type ChatCompletionRequest struct {
+	Model       string        `json:"model"`
+	Messages    []ChatMessage `json:"messages"`
+	MaxTokens   int           `json:"max_tokens,omitempty"`
+	Temperature *float64      `json:"temperature,omitempty"`
+	TopP        *float64      `json:"top_p,omitempty"`
+	Stop        []string      `json:"stop,omitempty"`
+}
+
+type anthropicRequest struct {
+	Model         string        `json:"model"`
+	System        string        `json:"system,omitempty"`
+	Messages      []ChatMessage `json:"messages"`
+	MaxTokens     int           `json:"max_tokens"`
+	Temperature   *float64      `json:"temperature,omitempty"`
+	TopP          *float64      `json:"top_p,omitempty"`
+	StopSequences []string      `json:"stop_sequences,omitempty"`
+}
+
+func (r ChatCompletionRequest) anthropic() anthropicRequest {
+	request := anthropicRequest{
+		Model:         r.Model,
+		MaxTokens:     r.MaxTokens,
+		Temperature:   r.Temperature,
+		TopP:          r.TopP,
+		StopSequences: r.Stop,
+	}
+	if request.MaxTokens <= 0 {
+		request.MaxTokens = anthropicMaxTokens
+	}
+	var system []string
+	for _, m := range r.Messages {
+		if m.Role == "system" {
+			system = append(system, m.Content)
+			continue
+		}
+		request.Messages = append(request.Messages, m)
+	}
+	request.System = strings.Join(system, "\n")
+	return request
+}
+
+// ChatCompletion is a chat completion response in the OpenAI format.
+type ChatCompletion struct {
+	Id      string                 `json:"id"`
+	Object  string                 `json:"object"`
+	Created int64                  `json:"created"`
+	Model   string                 `json:"model"`
+	Choices []ChatCompletionChoice `json:"choices"`
+	Usage   ChatCompletionUsage    `json:"usage"`
+}
+
+type ChatCompletionChoice struct {
+	Index        int         `json:"index"`
+	Message      ChatMessage `json:"message"`
+	FinishReason string      `json:"finish_reason"`
+}
+
+type ChatCompletionUsage struct {
+	PromptTokens     int `json:"prompt_tokens"`
+	CompletionTokens int `json:"completion_tokens"`
+	TotalTokens      int `json:"total_tokens"`
+}
+
+// Content returns the content of the first choice of the completion.
+func (c ChatCompletion) Content() string {
+	if len(c.Choices) == 0 {
+		return ""
+	}
+	return c.Choices[0].Message.Content
+}
+
+type anthropicResponse struct {
+	Id      string `json:"id"`
+	Type    string `json:"type"`
+	Role    string `json:"role"`
+	Model   string `json:"model"`
+	Content []struct {
+		Type string `json:"type"`
+		Text string `json:"text"`
+	} `json:"content"`
+	StopReason string `json:"stop_reason"`
+	Usage      struct {
+		InputTokens  int `json:"input_tokens"`
+		OutputTokens int `json:"output_tokens"`
+	} `json:"usage"`
+}
+
+func (r anthropicResponse) completion() ChatCompletion {
+	var text strings.Builder
+	for _, c := range r.Content {
+		if c.Type == "text" {
+			text.WriteString(c.Text)
+		}
+	}
+	reason := r.StopReason
+	switch reason {
+	case "end_turn", "stop_sequence":
+		reason = "stop"
+	case "max_tokens":
+		reason = "length"
+	}
+	return ChatCompletion{
+		Id:     r.Id,
+		Object: "chat.completion",
+		Model:  r.Model,
+		Choices: []ChatCompletionChoice{{
+			Message:      ChatMessage{Role: r.Role, Content: text.String()},
+			FinishReason: reason,
+		}},
+		Usage: ChatCompletionUsage{
+			PromptTokens:     r.Usage.InputTokens,
+			CompletionTokens: r.Usage.OutputTokens,
+			TotalTokens:      r.Usage.InputTokens + r.Usage.OutputTokens,
+		},
+	}
+}
+
+// ParseChatCompletion parses the response body of a llm api, in the OpenAI or the Anthropic format.
+func ParseChatCompletion(body []byte) (ChatCompletion, error) {
+	var probe struct {
+		Type string `json:"type"`
+	}
+	if err := json.Unmarshal(body, &probe); err != nil {
+		return ChatCompletion{}, err
+	}
+	if probe.Type == "message" {
+		response, err := parse[anthropicResponse](body)
+		if err != nil {
+			return ChatCompletion{}, err
+		}
+		return response.completion(), nil
+	}
+	return parse[ChatCompletion](body)
+}
+
+type ChatCompletionOptions struct {
+	// To is the llm destination, created with ToLLM.
+	To Destination
+	// Queue is the name of the queue the request is enqueued to, it is published directly when it is empty.
+	Queue   string
+	Request ChatCompletionRequest
+	// Callback is the url the completion is delivered to, since it is not returned by the publish request.
+	Callback        string
+	FailureCallback string
+	Retries         *int
+	Delay           string
+	Timeout         string
+}
+
+// PublishChatCompletion publishes or enqueues a chat completion request to a llm api.
+// The completion is delivered to the callback, whose body can be parsed with ParseChatCompletionCallback.
+func (c *Client) PublishChatCompletion(options ChatCompletionOptions) (result PublishOrEnqueueResponse, err error) {
+	if options.To.Type() != DestinationApi {
+		err = fmt.Errorf("a chat completion must be sent to a llm destination")
+		return
+	}
+	if err = options.To.Err(); err != nil {
+		return
+	}
+	if options.Callback == "" {
+		err = fmt.Errorf("`Callback` must be provided to receive the chat completion")
+		return
+	}
+	var body any = options.Request
+	if options.To.Provider() == AnthropicProvider {
+		body = options.Request.anthropic()
+	}
+	payload, err := json.Marshal(body)
+	if err != nil {
+		return
+	}
+	path := fmt.Sprintf("/v2/publish/%s", options.To)
+	if options.Queue != "" {
+		path = fmt.Sprintf("/v2/enqueue/%s/%s", options.Queue, options.To)
+	}
+	opts := requestOptions{
+		method: http.MethodPost,
+		path:   path,
+		body:   string(payload),
+		header: options.To.setHeaders(prepareHeaders(
+			"application/json",
+			"",
+			nil,
+			options.Retries,
+			options.Callback,
+			options.FailureCallback,
+			options.Delay,
+			"",
+			"",
+			false,
+			options.Timeout,
+			"",
+		)),
+	}
+	response, _, err := c.fetchWith(opts)
+	if err != nil {
+		return
+	}
+	result, err = parse[PublishOrEnqueueResponse](response)
+	return
+}
+
+// ParseChatCompletionCallback parses the body of the callback request of a chat completion published with PublishChatCompletion.
+// It returns an error with the response of the provider if the completion failed.
+func ParseChatCompletionCallback(body []byte) (ChatCompletion, error) {
+	callback, err := ParseCallbackPayload(body)
+	if err != nil {
+		return ChatCompletion{}, err
+	}
+	if !callback.Succeeded() {
+		return ChatCompletion{}, fmt.Errorf("chat completion failed with status %d: %s", callback.Status, callback.Body)
+	}
+	return ParseChatCompletion(callback.Body)
+}
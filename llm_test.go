@@ -0,0 +1,107 @@
+package qstash
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func TestToLLM(t *testing.T) {
+	d := ToLLM(LlmOptions{})
+	assert.NoError(t, d.Err())
+	assert.Equal(t, "api/llm", d.String())
+
+	d = ToLLM(LlmOptions{Provider: OpenAIProvider, ApiKey: "test-key"})
+	assert.NoError(t, d.Err())
+	assert.Equal(t, "https://api.openai.com/v1/chat/completions", d.String())
+	assert.Equal(t, "llm", d.Api())
+	assert.Equal(t, "Bearer test-key", d.header.Get("Upstash-Forward-Authorization"))
+
+	d = ToLLM(LlmOptions{Provider: CustomProvider, BaseUrl: "https://example.com/openai/v1/"})
+	assert.NoError(t, d.Err())
+	assert.Equal(t, "https://example.com/openai/v1/chat/completions", d.String())
+
+	d = ToLLM(LlmOptions{Provider: AnthropicProvider, ApiKey: "test-key"})
+	assert.NoError(t, d.Err())
+	assert.Equal(t, "https://api.anthropic.com/v1/messages", d.String())
+	assert.Equal(t, "test-key", d.header.Get("Upstash-Forward-X-Api-Key"))
+	assert.Equal(t, "2023-06-01", d.header.Get("Upstash-Forward-Anthropic-Version"))
+
+	assert.ErrorContains(t, ToLLM(LlmOptions{Provider: OpenAIProvider}).Err(), "`ApiKey` must be provided")
+	assert.ErrorContains(t, ToLLM(LlmOptions{Provider: CustomProvider}).Err(), "`BaseUrl` must be provided")
+	assert.ErrorContains(t, ToLLM(LlmOptions{Provider: "other"}).Err(), "unsupported api provider")
+}
+
+func TestChatCompletionAnthropic(t *testing.T) {
+	request := ChatCompletionRequest{
+		Model: "claude-3-5-haiku-latest",
+		Messages: []ChatMessage{
+			{Role: "system", Content: "Be brief."},
+			{Role: "user", Content: "hello"},
+		},
+		Stop: []string{"\n"},
+	}.anthropic()
+	assert.Equal(t, "Be brief.", request.System)
+	assert.Equal(t, []ChatMessage{{Role: "user", Content: "hello"}}, request.Messages)
+	assert.Equal(t, 1024, request.MaxTokens)
+	assert.Equal(t, []string{"\n"}, request.StopSequences)
+
+	completion, err := ParseChatCompletion([]byte(`{
+		"id": "msg_1", "type": "message", "role": "assistant", "model": "claude-3-5-haiku-latest",
+		"content": [{"type": "text", "text": "Hi!"}],
+		"stop_reason": "end_turn", "usage": {"input_tokens": 10, "output_tokens": 3}
+	}`))
+	assert.NoError(t, err)
+	assert.Equal(t, "Hi!", completion.Content())
+	assert.Equal(t, "stop", completion.Choices[0].FinishReason)
+	assert.Equal(t, 13, completion.Usage.TotalTokens)
+}
+
+func TestParseChatCompletionCallback(t *testing.T) {
+	response := `{"id": "chatcmpl-1", "object": "chat.completion", "model": "gpt-4o-mini",
+		"choices": [{"index": 0, "message": {"role": "assistant", "content": "Hello!"}, "finish_reason": "stop"}],
+		"usage": {"prompt_tokens": 9, "completion_tokens": 2, "total_tokens": 11}}`
+	body, _ := json.Marshal(map[string]any{
+		"status": 200,
+		"body":   base64.StdEncoding.EncodeToString([]byte(response)),
+	})
+	completion, err := ParseChatCompletionCallback(body)
+	assert.NoError(t, err)
+	assert.Equal(t, "Hello!", completion.Content())
+	assert.Equal(t, 11, completion.Usage.TotalTokens)
+
+	body = []byte(fmt.Sprintf(`{"status": 401, "body": "%s"}`, base64.StdEncoding.EncodeToString([]byte("invalid api key"))))
+	_, err = ParseChatCompletionCallback(body)
+	assert.ErrorContains(t, err, "chat completion failed with status 401: invalid api key")
+}
+
+func TestPublishChatCompletion(t *testing.T) {
+	client := NewClientWithEnv()
+
+	res, err := client.PublishChatCompletion(ChatCompletionOptions{
+		To: ToLLM(LlmOptions{Provider: OpenAIProvider, ApiKey: "test-key"}),
+		Request: ChatCompletionRequest{
+			Model:    "gpt-4o-mini",
+			Messages: []ChatMessage{{Role: "user", Content: "hello"}},
+		},
+		Callback: "https://example.com",
+		Delay:    FormatDelay(time.Hour),
+	})
+	assert.NoError(t, err)
+
+	message, err := client.Messages().Get(res.MessageId)
+	assert.NoError(t, err)
+	assert.Equal(t, "https://api.openai.com/v1/chat/completions", message.Url)
+	assert.Equal(t, "Bearer test-key", message.Header.Get("Authorization"))
+
+	err = client.Messages().Cancel(res.MessageId)
+	assert.NoError(t, err)
+
+	_, err = client.PublishChatCompletion(ChatCompletionOptions{
+		To: ToURL("https://example.com"),
+	})
+	assert.ErrorContains(t, err, "llm destination")
+}
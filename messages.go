@@ -4,6 +4,7 @@ import (
 	"encoding/json"
 	"fmt"
 	"net/http"
+	"time"
 )
 
 type Messages struct {
@@ -47,6 +48,16 @@ type Message struct {
 	Api string `json:"api,omitempty"`
 }
 
+// CreationTime returns the creation time of the message.
+func (m Message) CreationTime() time.Time {
+	return fromUnixMilli(m.CreatedAt)
+}
+
+// NotBeforeTime returns the time before which the message is not delivered, zero if it is not set.
+func (m Message) NotBeforeTime() time.Time {
+	return fromUnixMilli(m.NotBefore)
+}
+
 type PublishOrEnqueueResponse struct {
 	// MessageId is the unique identifier of new message.
 	MessageId string `json:"messageId"`
@@ -54,6 +65,8 @@ type PublishOrEnqueueResponse struct {
 	Deduplicated bool `json:"deduplicated,omitempty"`
 	// Url is the target address of the message if it was sent to a URL group, empty otherwise.
 	Url string `json:"url,omitempty"`
+	// EndpointName is the name of the endpoint if the message was sent to a named endpoint of a URL group, empty otherwise.
+	EndpointName string `json:"endpointName,omitempty"`
 }
 
 type batchResponse struct {
@@ -100,7 +113,7 @@ func (b *batchResponse) UnmarshalJSON(data []byte) (err error) {
 
 // Publish publishes a message to QStash.
 func (c *Client) Publish(options PublishOptions) (result PublishOrEnqueueResponse, err error) {
-	destination, err := getDestination(options.Url, "", options.Api)
+	destination, err := resolveSingleDestination(options.To, options.Url, options.Api)
 	if err != nil {
 		return
 	}
@@ -121,7 +134,7 @@ func (c *Client) Publish(options PublishOptions) (result PublishOrEnqueueRespons
 // PublishJSON publishes a message to QStash, automatically serializing the body as JSON string,
 // and setting content type to `application/json`.
 func (c *Client) PublishJSON(options PublishJSONOptions) (result PublishOrEnqueueResponse, err error) {
-	destination, err := getDestination(options.Url, "", options.Api)
+	destination, err := resolveSingleDestination(options.To, options.Url, options.Api)
 	if err != nil {
 		return
 	}
@@ -145,7 +158,7 @@ func (c *Client) PublishJSON(options PublishJSONOptions) (result PublishOrEnqueu
 
 // Enqueue enqueues a message, after creating the queue if it does not exist.
 func (c *Client) Enqueue(options EnqueueOptions) (result PublishOrEnqueueResponse, err error) {
-	destination, err := getDestination(options.Url, "", options.Api)
+	destination, err := resolveSingleDestination(options.To, options.Url, options.Api)
 	if err != nil {
 		return
 	}
@@ -166,7 +179,7 @@ func (c *Client) Enqueue(options EnqueueOptions) (result PublishOrEnqueueRespons
 // EnqueueJSON enqueues a message, after creating the queue if it does not exist.
 // It automatically serializes the body as JSON string, and setting content type to `application/json`.
 func (c *Client) EnqueueJSON(options EnqueueJSONOptions) (result PublishOrEnqueueResponse, err error) {
-	destination, err := getDestination(options.Url, "", options.Api)
+	destination, err := resolveSingleDestination(options.To, options.Url, options.Api)
 	if err != nil {
 		return
 	}
@@ -192,7 +205,7 @@ func (c *Client) EnqueueJSON(options EnqueueJSONOptions) (result PublishOrEnqueu
 func (c *Client) Batch(options []BatchOptions) (results [][]PublishOrEnqueueResponse, err error) {
 	messages := make([]map[string]interface{}, len(options))
 	for idx, option := range options {
-		destination, err := getDestination(option.Url, option.UrlGroup, option.Api)
+		destination, err := resolveDestination(option.To, option.Url, option.UrlGroup, option.Api)
 		if err != nil {
 			return nil, err
 		}
@@ -230,7 +243,7 @@ func (c *Client) BatchJSON(options []BatchJSONOptions) (results [][]PublishOrEnq
 	messages := make([]map[string]interface{}, len(options))
 
 	for idx, option := range options {
-		destination, err := getDestination(option.Url, option.UrlGroup, option.Api)
+		destination, err := resolveDestination(option.To, option.Url, option.UrlGroup, option.Api)
 		if err != nil {
 			return nil, err
 		}
@@ -48,6 +48,65 @@ func TestPublishToUrlWithDelay(t *testing.T) {
 
 }
 
+func TestPublishWithTypedOptions(t *testing.T) {
+	client := NewClientWithEnv()
+
+	notBefore := time.Now().Add(time.Hour)
+	res, err := client.Publish(PublishOptions{
+		Body:      "test-body",
+		Url:       "http://example.com",
+		NotBefore: FormatNotBefore(notBefore),
+		Timeout:   FormatDelay(1500 * time.Millisecond),
+	})
+	assert.NoError(t, err)
+
+	message, err := client.Messages().Get(res.MessageId)
+	assert.NoError(t, err)
+	assert.WithinDuration(t, notBefore, message.NotBeforeTime(), time.Second)
+	assert.WithinDuration(t, time.Now(), message.CreationTime(), time.Minute)
+
+	err = client.Messages().Cancel(res.MessageId)
+	assert.NoError(t, err)
+}
+
+func TestPublishToDestination(t *testing.T) {
+	client := NewClientWithEnv()
+
+	res, err := client.Publish(PublishOptions{
+		To:    ToURL("https://example.com"),
+		Body:  "test-body",
+		Delay: "1h",
+	})
+	assert.NoError(t, err)
+
+	message, err := client.Messages().Get(res.MessageId)
+	assert.NoError(t, err)
+	assert.Equal(t, ToURL("https://example.com"), message.Target())
+
+	err = client.Messages().Cancel(res.MessageId)
+	assert.NoError(t, err)
+
+	_, err = client.Publish(PublishOptions{
+		To:   ToURL("example.com"),
+		Body: "test-body",
+	})
+	assert.ErrorContains(t, err, "invalid destination url")
+
+	results, err := client.Batch([]BatchOptions{
+		{To: ToURL("https://example.com"), Body: "test-body"},
+		{To: ToURL("https://example.com"), Url: "https://example.com", Body: "test-body"},
+	})
+	assert.ErrorContains(t, err, "multiple destinations found")
+	assert.Empty(t, results)
+}
+
+func TestFormatDelay(t *testing.T) {
+	assert.Equal(t, "10s", FormatDelay(10*time.Second))
+	assert.Equal(t, "2s", FormatDelay(1500*time.Millisecond))
+	assert.Equal(t, "3600s", FormatDelay(time.Hour))
+	assert.Equal(t, "1700000000", FormatNotBefore(time.Unix(1700000000, 0)))
+}
+
 func TestPublishToJson(t *testing.T) {
 	client := NewClientWithEnv()
 
@@ -6,13 +6,31 @@ import (
 	"net/url"
 	"strconv"
 	"strings"
+	"time"
 )
 
 func RetryCount(val int) *int {
 	return &val
 }
 
+// FormatDelay formats a duration for the Delay and Timeout options, rounded up to whole seconds.
+func FormatDelay(d time.Duration) string {
+	seconds := d / time.Second
+	if d%time.Second > 0 {
+		seconds++
+	}
+	return fmt.Sprintf("%ds", seconds)
+}
+
+// FormatNotBefore formats a time for the NotBefore option, truncated to whole seconds.
+func FormatNotBefore(t time.Time) string {
+	return strconv.FormatInt(t.Unix(), 10)
+}
+
 type PublishOptions struct {
+	// To is the destination of the message, it is an alternative to setting Url or Api.
+	// Url group destinations are rejected, use PublishUrlGroupOptions instead.
+	To                        Destination
 	Url                       string
 	Api                       string
 	Body                      string
@@ -30,7 +48,7 @@ type PublishOptions struct {
 }
 
 func (m PublishOptions) headers() http.Header {
-	return prepareHeaders(
+	return m.To.setHeaders(prepareHeaders(
 		m.ContentType,
 		m.Method,
 		m.Headers,
@@ -43,7 +61,7 @@ func (m PublishOptions) headers() http.Header {
 		m.ContentBasedDeduplication,
 		m.Timeout,
 		"",
-	)
+	))
 }
 
 type PublishUrlGroupOptions struct {
@@ -80,6 +98,9 @@ func (m PublishUrlGroupOptions) headers() http.Header {
 }
 
 type PublishJSONOptions struct {
+	// To is the destination of the message, it is an alternative to setting Url or Api.
+	// Url group destinations are rejected, use PublishUrlGroupJSONOptions instead.
+	To                        Destination
 	Url                       string
 	Api                       string
 	Body                      map[string]any
@@ -96,7 +117,7 @@ type PublishJSONOptions struct {
 }
 
 func (m PublishJSONOptions) headers() http.Header {
-	return prepareHeaders(
+	return m.To.setHeaders(prepareHeaders(
 		"application/json",
 		m.Method,
 		m.Headers,
@@ -109,7 +130,7 @@ func (m PublishJSONOptions) headers() http.Header {
 		m.ContentBasedDeduplication,
 		m.Timeout,
 		"",
-	)
+	))
 }
 
 type PublishUrlGroupJSONOptions struct {
@@ -145,6 +166,9 @@ func (m PublishUrlGroupJSONOptions) headers() http.Header {
 }
 
 type EnqueueOptions struct {
+	// To is the destination of the message, it is an alternative to setting Url or Api.
+	// Url group destinations are rejected, use EnqueueUrlGroupOptions instead.
+	To                        Destination
 	Queue                     string
 	Url                       string
 	Api                       string
@@ -163,7 +187,7 @@ type EnqueueOptions struct {
 }
 
 func (m *EnqueueOptions) headers() http.Header {
-	return prepareHeaders(
+	return m.To.setHeaders(prepareHeaders(
 		m.ContentType,
 		m.Method,
 		m.Headers,
@@ -176,7 +200,7 @@ func (m *EnqueueOptions) headers() http.Header {
 		m.ContentBasedDeduplication,
 		m.Timeout,
 		"",
-	)
+	))
 }
 
 type EnqueueUrlGroupOptions struct {
@@ -214,6 +238,9 @@ func (m *EnqueueUrlGroupOptions) headers() http.Header {
 }
 
 type EnqueueJSONOptions struct {
+	// To is the destination of the message, it is an alternative to setting Url or Api.
+	// Url group destinations are rejected, use EnqueueUrlGroupJSONOptions instead.
+	To                        Destination
 	Queue                     string
 	Url                       string
 	Api                       string
@@ -231,7 +258,7 @@ type EnqueueJSONOptions struct {
 }
 
 func (m *EnqueueJSONOptions) headers() http.Header {
-	return prepareHeaders(
+	return m.To.setHeaders(prepareHeaders(
 		"application/json",
 		m.Method,
 		m.Headers,
@@ -244,7 +271,7 @@ func (m *EnqueueJSONOptions) headers() http.Header {
 		m.ContentBasedDeduplication,
 		m.Timeout,
 		"",
-	)
+	))
 }
 
 type EnqueueUrlGroupJSONOptions struct {
@@ -281,21 +308,35 @@ func (m *EnqueueUrlGroupJSONOptions) headers() http.Header {
 }
 
 type ScheduleOptions struct {
-	Cron            string
-	ContentType     string
-	Body            string
-	Destination     string
-	Method          string
-	Headers         map[string]string
-	Retries         *int
-	Callback        string
-	FailureCallback string
-	Delay           string
-	Timeout         string
+	// ScheduleId is the id of the schedule to create, the schedule is updated in place if it already exists.
+	// QStash assigns a random id when it is empty.
+	ScheduleId  string
+	Cron        string
+	ContentType string
+	Body        string
+	// Destination is the url or url group to send the messages to, it is an alternative to setting one of To, Url, UrlGroup or Api.
+	Destination string
+	// To is the destination of the messages, it is an alternative to setting one of Url, UrlGroup or Api.
+	To       Destination
+	Url      string
+	UrlGroup string
+	Api      string
+	// Queue is the name of the queue the messages are enqueued to, the messages are published directly when it is empty.
+	Queue                     string
+	Method                    string
+	Headers                   map[string]string
+	Retries                   *int
+	Callback                  string
+	FailureCallback           string
+	Delay                     string
+	NotBefore                 string
+	Timeout                   string
+	DeduplicationId           string
+	ContentBasedDeduplication bool
 }
 
 func (m *ScheduleOptions) headers() http.Header {
-	return prepareHeaders(
+	header := prepareHeaders(
 		m.ContentType,
 		m.Method,
 		m.Headers,
@@ -303,29 +344,54 @@ func (m *ScheduleOptions) headers() http.Header {
 		m.Callback,
 		m.FailureCallback,
 		m.Delay,
-		"",
-		"",
-		false,
+		m.NotBefore,
+		m.DeduplicationId,
+		m.ContentBasedDeduplication,
 		m.Timeout,
 		m.Cron,
 	)
+	if m.ScheduleId != "" {
+		header.Set(upstashScheduleIdHeader, m.ScheduleId)
+	}
+	if m.Queue != "" {
+		header.Set(upstashQueueNameHeader, m.Queue)
+	}
+	return m.To.setHeaders(header)
+}
+
+func (m *ScheduleOptions) destination() (string, error) {
+	return getScheduleDestination(m.Destination, m.To, m.Url, m.UrlGroup, m.Api)
 }
 
 type ScheduleJSONOptions struct {
-	Cron            string
-	Body            map[string]any
-	Destination     string
-	Method          string
-	Headers         map[string]string
-	Retries         *int
-	Callback        string
-	FailureCallback string
-	Delay           string
-	Timeout         string
+	// ScheduleId is the id of the schedule to create, the schedule is updated in place if it already exists.
+	// QStash assigns a random id when it is empty.
+	ScheduleId string
+	Cron       string
+	Body       map[string]any
+	// Destination is the url or url group to send the messages to, it is an alternative to setting one of To, Url, UrlGroup or Api.
+	Destination string
+	// To is the destination of the messages, it is an alternative to setting one of Url, UrlGroup or Api.
+	To       Destination
+	Url      string
+	UrlGroup string
+	Api      string
+	// Queue is the name of the queue the messages are enqueued to, the messages are published directly when it is empty.
+	Queue                     string
+	Method                    string
+	Headers                   map[string]string
+	Retries                   *int
+	Callback                  string
+	FailureCallback           string
+	Delay                     string
+	NotBefore                 string
+	Timeout                   string
+	DeduplicationId           string
+	ContentBasedDeduplication bool
 }
 
 func (m *ScheduleJSONOptions) headers() http.Header {
-	return prepareHeaders(
+	header := prepareHeaders(
 		"application/json",
 		m.Method,
 		m.Headers,
@@ -333,15 +399,28 @@ func (m *ScheduleJSONOptions) headers() http.Header {
 		m.Callback,
 		m.FailureCallback,
 		m.Delay,
-		"",
-		"",
-		false,
+		m.NotBefore,
+		m.DeduplicationId,
+		m.ContentBasedDeduplication,
 		m.Timeout,
 		m.Cron,
 	)
+	if m.ScheduleId != "" {
+		header.Set(upstashScheduleIdHeader, m.ScheduleId)
+	}
+	if m.Queue != "" {
+		header.Set(upstashQueueNameHeader, m.Queue)
+	}
+	return m.To.setHeaders(header)
+}
+
+func (m *ScheduleJSONOptions) destination() (string, error) {
+	return getScheduleDestination(m.Destination, m.To, m.Url, m.UrlGroup, m.Api)
 }
 
 type BatchOptions struct {
+	// To is the destination of the message, it is an alternative to setting one of Url, UrlGroup or Api.
+	To                        Destination
 	Queue                     string
 	Url                       string
 	UrlGroup                  string
@@ -398,10 +477,15 @@ func (m *BatchOptions) headers() map[string]string {
 	if m.Timeout != "" {
 		header[upstashTimeoutHeader] = m.Timeout
 	}
+	for k, v := range m.To.header {
+		header[k] = v[0]
+	}
 	return header
 }
 
 type BatchJSONOptions struct {
+	// To is the destination of the message, it is an alternative to setting one of Url, UrlGroup or Api.
+	To                        Destination
 	Queue                     string
 	Url                       string
 	UrlGroup                  string
@@ -455,6 +539,9 @@ func (m *BatchJSONOptions) headers() map[string]string {
 	if m.Timeout != "" {
 		header[upstashTimeoutHeader] = m.Timeout
 	}
+	for k, v := range m.To.header {
+		header[k] = v[0]
+	}
 	return header
 }
 
@@ -4,6 +4,7 @@ import (
 	"encoding/json"
 	"fmt"
 	"net/http"
+	"time"
 )
 
 // Queues in QStash are mechanisms that ensure ordered delivery (FIFO) and allow controlled parallelism in processing messages.
@@ -29,6 +30,16 @@ type QueueWithLag struct {
 	IsPaused bool `json:"paused"`
 }
 
+// CreationTime returns the creation time of the queue.
+func (q QueueWithLag) CreationTime() time.Time {
+	return fromUnixMilli(q.CreatedAt)
+}
+
+// UpdateTime returns the last update time of the queue.
+func (q QueueWithLag) UpdateTime() time.Time {
+	return fromUnixMilli(q.UpdatedAt)
+}
+
 type Queue struct {
 	// Name is the name of the queue
 	Name string `json:"queueName" validate:"required"`
@@ -0,0 +1,196 @@
+package qstash
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+)
+
+type AutoscalePolicy struct {
+	// Min is the lowest parallelism of the queue, 1 by default.
+	Min int
+	// Max is the highest parallelism of the queue, Min by default.
+	Max int
+	// TargetLag is the number of unprocessed messages per unit of parallelism the autoscaler aims for, 10 by default.
+	TargetLag int64
+	// Step is the maximum change of parallelism in a single decision, 1 by default.
+	Step int
+	// Cooldown is the minimum duration between two changes of parallelism of the queue.
+	Cooldown time.Duration
+}
+
+func (p *AutoscalePolicy) init() {
+	if p.Min <= 0 {
+		p.Min = 1
+	}
+	if p.Max < p.Min {
+		p.Max = p.Min
+	}
+	if p.TargetLag <= 0 {
+		p.TargetLag = 10
+	}
+	if p.Step <= 0 {
+		p.Step = 1
+	}
+}
+
+type AutoscaleReason string
+
+var (
+	AutoscaleUp       AutoscaleReason = "scale up"
+	AutoscaleDown     AutoscaleReason = "scale down"
+	AutoscaleSteady   AutoscaleReason = "steady"
+	AutoscaleCooldown AutoscaleReason = "cooldown"
+)
+
+type AutoscaleDecision struct {
+	// Queue is the name of the queue.
+	Queue string
+	// Lag is the number of unprocessed messages in the queue when the decision was made.
+	Lag int64
+	// From is the parallelism of the queue before the decision.
+	From int
+	// To is the parallelism of the queue after the decision, equal to From if it is unchanged.
+	To int
+	// Reason explains the decision.
+	Reason AutoscaleReason
+	// Time is when the decision was made.
+	Time time.Time
+}
+
+type QueueAutoscalerOptions struct {
+	// Queues is the policy of each queue to scale, by queue name.
+	Queues map[string]AutoscalePolicy
+	// Interval is the duration between two evaluations of the queues, 30 seconds by default.
+	Interval time.Duration
+	// OnDecision is called for every decision, including the ones that leave the parallelism unchanged.
+	OnDecision func(decision AutoscaleDecision)
+	// OnError is called when a queue can not be read or updated while running.
+	OnError func(queue string, err error)
+}
+
+// autoscaledQueues reads and updates the queues of an autoscaler, it is implemented by Queues.
+type autoscaledQueues interface {
+	Get(name string) (QueueWithLag, error)
+	Upsert(queue Queue) error
+}
+
+// QueueAutoscaler periodically reads the lag of queues and adjusts their parallelism within the bounds of their policy.
+type QueueAutoscaler struct {
+	queues     autoscaledQueues
+	options    QueueAutoscalerOptions
+	mu         sync.Mutex
+	lastChange map[string]time.Time
+	now        func() time.Time
+}
+
+func NewQueueAutoscaler(client *Client, options QueueAutoscalerOptions) *QueueAutoscaler {
+	if options.Interval <= 0 {
+		options.Interval = 30 * time.Second
+	}
+	queues := make(map[string]AutoscalePolicy, len(options.Queues))
+	for name, policy := range options.Queues {
+		policy.init()
+		queues[name] = policy
+	}
+	options.Queues = queues
+	return &QueueAutoscaler{
+		queues:     client.Queues(),
+		options:    options,
+		lastChange: map[string]time.Time{},
+		now:        time.Now,
+	}
+}
+
+// Run evaluates the queues at every interval until the context is done.
+func (a *QueueAutoscaler) Run(ctx context.Context) error {
+	ticker := time.NewTicker(a.options.Interval)
+	defer ticker.Stop()
+	for {
+		_, _ = a.Evaluate(ctx)
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+// Evaluate reads the lag of every configured queue once, updates the parallelism of the ones that need it,
+// and returns the decisions made. Errors of individual queues are reported to OnError and joined in the returned error.
+func (a *QueueAutoscaler) Evaluate(ctx context.Context) ([]AutoscaleDecision, error) {
+	var decisions []AutoscaleDecision
+	var errs []error
+	for name, policy := range a.options.Queues {
+		if err := ctx.Err(); err != nil {
+			return decisions, err
+		}
+		decision, err := a.evaluate(name, policy)
+		if err != nil {
+			if a.options.OnError != nil {
+				a.options.OnError(name, err)
+			}
+			errs = append(errs, err)
+			continue
+		}
+		if a.options.OnDecision != nil {
+			a.options.OnDecision(decision)
+		}
+		decisions = append(decisions, decision)
+	}
+	return decisions, errors.Join(errs...)
+}
+
+func (a *QueueAutoscaler) evaluate(name string, policy AutoscalePolicy) (AutoscaleDecision, error) {
+	queue, err := a.queues.Get(name)
+	if err != nil {
+		return AutoscaleDecision{}, err
+	}
+	now := a.now()
+	a.mu.Lock()
+	last := a.lastChange[name]
+	a.mu.Unlock()
+
+	decision := decide(policy, queue.Parallelism, queue.Lag, now.Sub(last))
+	decision.Queue = name
+	decision.Time = now
+	if decision.To == decision.From {
+		return decision, nil
+	}
+	err = a.queues.Upsert(Queue{
+		Name:        name,
+		Parallelism: decision.To,
+		IsPaused:    queue.IsPaused,
+	})
+	if err != nil {
+		return AutoscaleDecision{}, err
+	}
+	a.mu.Lock()
+	a.lastChange[name] = now
+	a.mu.Unlock()
+	return decision, nil
+}
+
+// decide computes the parallelism that brings the lag per unit of parallelism to the target,
+// moving by at most one step from the current parallelism and staying within the bounds of the policy.
+func decide(policy AutoscalePolicy, parallelism int, lag int64, sinceLastChange time.Duration) AutoscaleDecision {
+	decision := AutoscaleDecision{Lag: lag, From: parallelism, To: parallelism, Reason: AutoscaleSteady}
+	desired := int((lag + policy.TargetLag - 1) / policy.TargetLag)
+	desired = min(max(desired, policy.Min), policy.Max)
+	desired = min(max(desired, parallelism-policy.Step), parallelism+policy.Step)
+	if desired == parallelism {
+		return decision
+	}
+	if sinceLastChange < policy.Cooldown {
+		decision.Reason = AutoscaleCooldown
+		return decision
+	}
+	decision.To = desired
+	if desired > parallelism {
+		decision.Reason = AutoscaleUp
+	} else {
+		decision.Reason = AutoscaleDown
+	}
+	return decision
+}
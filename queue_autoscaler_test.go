@@ -0,0 +1,97 @@
+package qstash
+
+import (
+	"context"
+	"fmt"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func TestAutoscaleDecide(t *testing.T) {
+	policy := AutoscalePolicy{Min: 1, Max: 4, TargetLag: 10, Step: 2, Cooldown: time.Minute}
+	policy.init()
+
+	decision := decide(policy, 1, 100, time.Hour)
+	assert.Equal(t, AutoscaleUp, decision.Reason)
+	assert.Equal(t, 3, decision.To)
+
+	decision = decide(policy, 3, 100, time.Hour)
+	assert.Equal(t, 4, decision.To)
+
+	decision = decide(policy, 4, 35, time.Hour)
+	assert.Equal(t, AutoscaleSteady, decision.Reason)
+	assert.Equal(t, 4, decision.To)
+
+	decision = decide(policy, 4, 0, time.Hour)
+	assert.Equal(t, AutoscaleDown, decision.Reason)
+	assert.Equal(t, 2, decision.To)
+
+	decision = decide(policy, 4, 0, time.Second)
+	assert.Equal(t, AutoscaleCooldown, decision.Reason)
+	assert.Equal(t, 4, decision.To)
+}
+
+// fakeQueues keeps queues in memory, with a fixed lag.
+type fakeQueues struct {
+	queues map[string]QueueWithLag
+}
+
+func (f *fakeQueues) Get(name string) (QueueWithLag, error) {
+	queue, ok := f.queues[name]
+	if !ok {
+		return QueueWithLag{}, fmt.Errorf("queue %s not found", name)
+	}
+	return queue, nil
+}
+
+func (f *fakeQueues) Upsert(queue Queue) error {
+	q := f.queues[queue.Name]
+	q.Name = queue.Name
+	q.Parallelism = queue.Parallelism
+	q.IsPaused = queue.IsPaused
+	f.queues[queue.Name] = q
+	return nil
+}
+
+func TestQueueAutoscaler(t *testing.T) {
+	name := "test-autoscaled-queue"
+	queues := &fakeQueues{queues: map[string]QueueWithLag{}}
+	queues.queues[name] = QueueWithLag{Name: name, Parallelism: 1, IsPaused: true, Lag: 3}
+
+	var observed []AutoscaleDecision
+	autoscaler := NewQueueAutoscaler(NewClient("token"), QueueAutoscalerOptions{
+		Queues: map[string]AutoscalePolicy{
+			name:      {Min: 1, Max: 5, TargetLag: 1, Cooldown: time.Hour},
+			"missing": {Min: 1, Max: 5},
+		},
+		OnDecision: func(decision AutoscaleDecision) {
+			observed = append(observed, decision)
+		},
+	})
+	autoscaler.queues = queues
+	now := time.Date(2024, time.January, 1, 0, 0, 0, 0, time.UTC)
+	autoscaler.now = func() time.Time { return now }
+
+	decisions, err := autoscaler.Evaluate(context.Background())
+	assert.ErrorContains(t, err, "queue missing not found")
+	assert.Len(t, decisions, 1)
+	assert.Equal(t, AutoscaleUp, decisions[0].Reason)
+	assert.Equal(t, int64(3), decisions[0].Lag)
+	assert.Equal(t, 2, decisions[0].To)
+	assert.Equal(t, now, decisions[0].Time)
+	assert.Equal(t, decisions, observed)
+
+	queue, err := queues.Get(name)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, queue.Parallelism)
+	assert.True(t, queue.IsPaused)
+
+	decisions, _ = autoscaler.Evaluate(context.Background())
+	assert.Equal(t, AutoscaleCooldown, decisions[0].Reason)
+
+	now = now.Add(time.Hour)
+	decisions, _ = autoscaler.Evaluate(context.Background())
+	assert.Equal(t, AutoscaleUp, decisions[0].Reason)
+	assert.Equal(t, 3, decisions[0].To)
+}
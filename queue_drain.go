@@ -0,0 +1,124 @@
+package qstash
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+var (
+	ErrQueuePaused = fmt.Errorf("queue is paused")
+)
+
+type DrainOptions struct {
+	// Timeout is the maximum duration to wait for the queue to drain, no limit other than the context by default.
+	Timeout time.Duration
+	// Interval is the duration between two reads of the lag, 1 second by default.
+	Interval time.Duration
+	// OnProgress is called with the lag of the queue after each read.
+	OnProgress func(lag int64)
+}
+
+// Drain waits until the queue has no unprocessed messages left.
+// It returns ErrQueuePaused if the queue is paused, since a paused queue does not deliver its messages.
+// Enqueuing to the queue should be stopped beforehand, otherwise it may never drain.
+func (c *Queues) Drain(ctx context.Context, name string, options DrainOptions) error {
+	if options.Interval <= 0 {
+		options.Interval = time.Second
+	}
+	if options.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, options.Timeout)
+		defer cancel()
+	}
+	ticker := time.NewTicker(options.Interval)
+	defer ticker.Stop()
+	for {
+		queue, err := c.Get(name)
+		if err != nil {
+			return err
+		}
+		if options.OnProgress != nil {
+			options.OnProgress(queue.Lag)
+		}
+		if queue.Lag == 0 {
+			return nil
+		}
+		if queue.IsPaused {
+			return fmt.Errorf("failed to drain queue %s: %w", name, ErrQueuePaused)
+		}
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("failed to drain queue %s with lag %d: %w", name, queue.Lag, ctx.Err())
+		case <-ticker.C:
+		}
+	}
+}
+
+type MigrateStep string
+
+var (
+	MigrateCreate MigrateStep = "create"
+	MigratePause  MigrateStep = "pause"
+	MigrateResume MigrateStep = "resume"
+	MigrateDrain  MigrateStep = "drain"
+	MigrateDelete MigrateStep = "delete"
+)
+
+type MigrateOptions struct {
+	// Drain configures how the source queue is drained.
+	Drain DrainOptions
+	// OnStep is called before each step of the migration.
+	OnStep func(step MigrateStep)
+	// PauseSource pauses the source before draining it instead of resuming it.
+	// Since a paused queue does not deliver its messages, the migration then only succeeds if the source has no lag,
+	// and fails with ErrQueuePaused otherwise, leaving the source paused with its messages.
+	PauseSource bool
+}
+
+// Migrate moves a queue to a new name.
+// It creates the destination queue with the parallelism of the source, drains the source and deletes it.
+// Producers should enqueue to the destination before the migration starts, as QStash can not refuse new messages on the source.
+// A paused source is resumed, because its messages would otherwise never be delivered,
+// unless PauseSource is set, in which case the source is paused and must already be empty.
+func (c *Queues) Migrate(ctx context.Context, from, to string, options MigrateOptions) error {
+	step := func(s MigrateStep) {
+		if options.OnStep != nil {
+			options.OnStep(s)
+		}
+	}
+	source, err := c.Get(from)
+	if err != nil {
+		return err
+	}
+
+	step(MigrateCreate)
+	err = c.Upsert(Queue{
+		Name:        to,
+		Parallelism: source.Parallelism,
+	})
+	if err != nil {
+		return err
+	}
+
+	switch {
+	case options.PauseSource && !source.IsPaused:
+		step(MigratePause)
+		if err = c.Pause(from); err != nil {
+			return err
+		}
+	case !options.PauseSource && source.IsPaused:
+		step(MigrateResume)
+		if err = c.Resume(from); err != nil {
+			return err
+		}
+	}
+
+	step(MigrateDrain)
+	if err = c.Drain(ctx, from, options.Drain); err != nil {
+		return err
+	}
+
+	step(MigrateDelete)
+	return c.Delete(from)
+}
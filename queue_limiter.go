@@ -0,0 +1,180 @@
+package qstash
+
+import (
+	"net/http"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+)
+
+type QueueLimiterOptions struct {
+	// Limit is the maximum number of requests handled concurrently per key, 1 by default.
+	Limit int
+	// Limits overrides Limit for specific keys, such as the queues that have a higher parallelism.
+	Limits map[string]int
+	// Key returns the key a request is limited by, the `Upstash-Queue-Name` header by default.
+	// Requests with an empty key are not limited.
+	Key func(r *http.Request) string
+	// RetryAfter is the duration sent in the `Retry-After` header of rejected requests, 1 second by default.
+	RetryAfter time.Duration
+	// IdleTimeout is the duration after which the state of a key without requests in flight is dropped, 10 minutes by default.
+	// The keys of Limits are never dropped, the others come from request headers and would otherwise grow without bound.
+	IdleTimeout time.Duration
+}
+
+// QueueLimiter limits the number of requests handled concurrently by a receiving service.
+// It complements the parallelism of queues, which only limits the concurrent deliveries of a single queue,
+// and rejects the requests over the limit with 429 Too Many Requests so that QStash retries them later.
+type QueueLimiter struct {
+	options   QueueLimiterOptions
+	mu        sync.Mutex
+	states    map[string]*limiterState
+	lastSweep time.Time
+}
+
+type limiterState struct {
+	inFlight  int
+	peak      int
+	accepted  uint64
+	rejected  uint64
+	idleSince time.Time
+}
+
+type QueueLimiterStats struct {
+	// Key is the key the requests are limited by.
+	Key string
+	// Limit is the maximum number of concurrent requests for the key.
+	Limit int
+	// InFlight is the number of requests currently handled.
+	InFlight int
+	// Peak is the highest number of requests handled at the same time.
+	Peak int
+	// Accepted is the number of requests that were handled.
+	Accepted uint64
+	// Rejected is the number of requests that were rejected because the limit was reached.
+	Rejected uint64
+}
+
+// Saturation returns the ratio of requests currently handled to the limit, between 0 and 1.
+func (s QueueLimiterStats) Saturation() float64 {
+	return float64(s.InFlight) / float64(s.Limit)
+}
+
+func NewQueueLimiter(options QueueLimiterOptions) *QueueLimiter {
+	if options.Limit <= 0 {
+		options.Limit = 1
+	}
+	if options.Key == nil {
+		options.Key = func(r *http.Request) string {
+			return r.Header.Get(upstashQueueNameHeader)
+		}
+	}
+	if options.RetryAfter <= 0 {
+		options.RetryAfter = time.Second
+	}
+	if options.IdleTimeout <= 0 {
+		options.IdleTimeout = 10 * time.Minute
+	}
+	return &QueueLimiter{
+		options:   options,
+		states:    map[string]*limiterState{},
+		lastSweep: time.Now(),
+	}
+}
+
+func (l *QueueLimiter) limit(key string) int {
+	if limit, ok := l.options.Limits[key]; ok && limit > 0 {
+		return limit
+	}
+	return l.options.Limit
+}
+
+// Acquire reserves a slot for the given key, and returns a function to release it once the work is done.
+// It returns false without blocking if the limit of the key is reached.
+func (l *QueueLimiter) Acquire(key string) (release func(), ok bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	now := time.Now()
+	if now.Sub(l.lastSweep) >= l.options.IdleTimeout {
+		l.sweep(now)
+	}
+	state, found := l.states[key]
+	if !found {
+		state = &limiterState{idleSince: now}
+		l.states[key] = state
+	}
+	if state.inFlight >= l.limit(key) {
+		state.rejected++
+		return nil, false
+	}
+	state.inFlight++
+	state.accepted++
+	state.peak = max(state.peak, state.inFlight)
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			l.mu.Lock()
+			defer l.mu.Unlock()
+			state.inFlight--
+			if state.inFlight == 0 {
+				state.idleSince = time.Now()
+			}
+		})
+	}, true
+}
+
+// sweep drops the states of the keys that have been idle for longer than IdleTimeout.
+func (l *QueueLimiter) sweep(now time.Time) {
+	l.lastSweep = now
+	for key, state := range l.states {
+		if _, ok := l.options.Limits[key]; ok {
+			continue
+		}
+		if state.inFlight == 0 && now.Sub(state.idleSince) >= l.options.IdleTimeout {
+			delete(l.states, key)
+		}
+	}
+}
+
+// Handler wraps an HTTP handler, rejecting the requests over the limit of their key
+// with 429 Too Many Requests and a `Retry-After` header.
+func (l *QueueLimiter) Handler(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		key := l.options.Key(r)
+		if key == "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+		release, ok := l.Acquire(key)
+		if !ok {
+			seconds := int((l.options.RetryAfter + time.Second - 1) / time.Second)
+			w.Header().Set("Retry-After", strconv.Itoa(seconds))
+			http.Error(w, http.StatusText(http.StatusTooManyRequests), http.StatusTooManyRequests)
+			return
+		}
+		defer release()
+		next.ServeHTTP(w, r)
+	})
+}
+
+// Stats returns the saturation metrics of the keys seen within IdleTimeout and of the keys of Limits, sorted by key.
+func (l *QueueLimiter) Stats() []QueueLimiterStats {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	stats := make([]QueueLimiterStats, 0, len(l.states))
+	for key, state := range l.states {
+		stats = append(stats, QueueLimiterStats{
+			Key:      key,
+			Limit:    l.limit(key),
+			InFlight: state.inFlight,
+			Peak:     state.peak,
+			Accepted: state.accepted,
+			Rejected: state.rejected,
+		})
+	}
+	sort.Slice(stats, func(i, j int) bool {
+		return stats[i].Key < stats[j].Key
+	})
+	return stats
+}
@@ -0,0 +1,109 @@
+package qstash
+
+import (
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestQueueLimiter(t *testing.T) {
+	limiter := NewQueueLimiter(QueueLimiterOptions{
+		Limit:      1,
+		Limits:     map[string]int{"wide": 2},
+		RetryAfter: 1500 * time.Millisecond,
+	})
+
+	started := make(chan struct{})
+	unblock := make(chan struct{})
+	handler := limiter.Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		started <- struct{}{}
+		<-unblock
+	}))
+
+	request := func(queue string) *http.Request {
+		r := httptest.NewRequest(http.MethodPost, "/", nil)
+		if queue != "" {
+			r.Header.Set("Upstash-Queue-Name", queue)
+		}
+		return r
+	}
+
+	done := make(chan struct{})
+	go func() {
+		handler.ServeHTTP(httptest.NewRecorder(), request("narrow"))
+		close(done)
+	}()
+	<-started
+
+	rejected := httptest.NewRecorder()
+	handler.ServeHTTP(rejected, request("narrow"))
+	assert.Equal(t, http.StatusTooManyRequests, rejected.Code)
+	assert.Equal(t, "2", rejected.Header().Get("Retry-After"))
+
+	// Other keys and requests without a queue have their own limit.
+	for _, queue := range []string{"wide", "wide", ""} {
+		go handler.ServeHTTP(httptest.NewRecorder(), request(queue))
+		<-started
+	}
+
+	stats := limiter.Stats()
+	assert.Len(t, stats, 2)
+	assert.Equal(t, QueueLimiterStats{Key: "narrow", Limit: 1, InFlight: 1, Peak: 1, Accepted: 1, Rejected: 1}, stats[0])
+	assert.Equal(t, "wide", stats[1].Key)
+	assert.Equal(t, 1.0, stats[1].Saturation())
+
+	close(unblock)
+	<-done
+	assert.Eventually(t, func() bool {
+		return limiter.Stats()[1].InFlight == 0
+	}, time.Second, 10*time.Millisecond)
+	assert.Equal(t, 0, limiter.Stats()[0].InFlight)
+	assert.Equal(t, 2, limiter.Stats()[1].Peak)
+}
+
+func TestQueueLimiterAcquire(t *testing.T) {
+	limiter := NewQueueLimiter(QueueLimiterOptions{Limit: 1})
+
+	release, ok := limiter.Acquire("key")
+	assert.True(t, ok)
+	_, ok = limiter.Acquire("key")
+	assert.False(t, ok)
+
+	release()
+	release()
+	release, ok = limiter.Acquire("key")
+	assert.True(t, ok)
+	release()
+	assert.Equal(t, 0, limiter.Stats()[0].InFlight)
+}
+
+func TestQueueLimiterEvictsIdleKeys(t *testing.T) {
+	limiter := NewQueueLimiter(QueueLimiterOptions{
+		Limits:      map[string]int{"configured": 2},
+		IdleTimeout: 10 * time.Millisecond,
+	})
+
+	release, ok := limiter.Acquire("configured")
+	assert.True(t, ok)
+	release()
+	release, ok = limiter.Acquire("idle")
+	assert.True(t, ok)
+	release()
+	busy, ok := limiter.Acquire("busy")
+	assert.True(t, ok)
+	assert.Len(t, limiter.Stats(), 3)
+
+	time.Sleep(20 * time.Millisecond)
+	release, ok = limiter.Acquire("new")
+	assert.True(t, ok)
+	release()
+	busy()
+
+	var keys []string
+	for _, stats := range limiter.Stats() {
+		keys = append(keys, stats.Key)
+	}
+	assert.Equal(t, []string{"busy", "configured", "new"}, keys)
+}
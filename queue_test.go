@@ -1,8 +1,10 @@
 package qstash
 
 import (
+	"context"
 	"github.com/stretchr/testify/assert"
 	"testing"
+	"time"
 )
 
 func TestQueue(t *testing.T) {
@@ -96,3 +98,55 @@ func TestQueuePauseAndResume(t *testing.T) {
 	assert.NoError(t, err)
 	assert.False(t, queue.IsPaused)
 }
+
+func TestQueueDrainAndMigrate(t *testing.T) {
+	client := NewClientWithEnv()
+
+	from, to := "test-queue-source", "test-queue-destination"
+	err := client.Queues().Upsert(Queue{
+		Name:        from,
+		Parallelism: 2,
+		IsPaused:    true,
+	})
+	assert.NoError(t, err)
+
+	for i := 0; i < 3; i++ {
+		_, err = client.Enqueue(EnqueueOptions{
+			Queue: from,
+			Url:   "https://example.com",
+			Body:  "test-body",
+		})
+		assert.NoError(t, err)
+	}
+
+	err = client.Queues().Drain(context.Background(), from, DrainOptions{Interval: 10 * time.Millisecond})
+	assert.ErrorIs(t, err, ErrQueuePaused)
+
+	err = client.Queues().Migrate(context.Background(), from, to, MigrateOptions{PauseSource: true})
+	assert.ErrorIs(t, err, ErrQueuePaused)
+
+	var steps []MigrateStep
+	var lags []int64
+	err = client.Queues().Migrate(context.Background(), from, to, MigrateOptions{
+		Drain: DrainOptions{
+			Interval:   10 * time.Millisecond,
+			Timeout:    time.Minute,
+			OnProgress: func(lag int64) { lags = append(lags, lag) },
+		},
+		OnStep: func(step MigrateStep) { steps = append(steps, step) },
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, []MigrateStep{MigrateCreate, MigrateResume, MigrateDrain, MigrateDelete}, steps)
+	assert.Equal(t, int64(0), lags[len(lags)-1])
+
+	queue, err := client.Queues().Get(to)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, queue.Parallelism)
+	assert.False(t, queue.IsPaused)
+
+	_, err = client.Queues().Get(from)
+	assert.Error(t, err)
+
+	err = client.Queues().Delete(to)
+	assert.NoError(t, err)
+}
@@ -7,6 +7,9 @@ import (
 	"fmt"
 	"github.com/golang-jwt/jwt/v5"
 	"github.com/stretchr/testify/assert"
+	"io"
+	"net/http"
+	"net/http/httptest"
 	"os"
 	"strings"
 	"testing"
@@ -83,3 +86,25 @@ func TestFailedVerify(t *testing.T) {
 	})
 	assert.Error(t, err)
 }
+
+func TestReceiverMiddleware(t *testing.T) {
+	key := "test-key"
+	middleware := NewReceiver(key, key).Middleware(VerifyRequestOptions{BaseUrl: "https://example.com/"})
+	handler := middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		_, _ = w.Write(body)
+	}))
+
+	signature, err := sign("body", key)
+	assert.NoError(t, err)
+	for path, status := range map[string]int{"/": http.StatusOK, "/other": http.StatusUnauthorized} {
+		r := httptest.NewRequest(http.MethodPost, path, strings.NewReader("body"))
+		r.Header.Set("Upstash-Signature", signature)
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, r)
+		assert.Equal(t, status, w.Code, path)
+		if status == http.StatusOK {
+			assert.Equal(t, "body", w.Body.String())
+		}
+	}
+}
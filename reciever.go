@@ -1,11 +1,14 @@
 package qstash
 
 import (
+	"bytes"
 	"crypto/sha256"
 	"encoding/base64"
 	"errors"
 	"fmt"
 	"github.com/golang-jwt/jwt/v5"
+	"io"
+	"net/http"
 	"os"
 	"strings"
 	"time"
@@ -19,6 +22,8 @@ var (
 type Receiver struct {
 	CurrentSigningKey string
 	NextSigningKey    string
+	// KeyProvider provides the signing keys when it is set, instead of CurrentSigningKey and NextSigningKey.
+	KeyProvider KeyProvider
 }
 
 func NewReceiverWithEnv() *Receiver {
@@ -35,6 +40,12 @@ func NewReceiver(currentSigningKey, nextSigningKey string) *Receiver {
 	}
 }
 
+// NewReceiverWithKeyProvider initializes a receiver that verifies the signatures with the keys of the provider,
+// such as a KeysProvider that follows the rotations of the keys without a restart.
+func NewReceiverWithKeyProvider(provider KeyProvider) *Receiver {
+	return &Receiver{KeyProvider: provider}
+}
+
 type claims struct {
 	Body string `json:"body"`
 	jwt.RegisteredClaims
@@ -81,10 +92,75 @@ type VerifyOptions struct {
 // Verify verifies the signature of a request.
 // It tries to verify the signature with the current signing key.
 // If that fails, maybe because you have rotated the keys recently, it will try to verify the signature with the next signing key.
+// When the receiver has a KeyProvider, the keys are refreshed and the signature verified again if that fails too.
 func (r *Receiver) Verify(opts VerifyOptions) (err error) {
-	err = verify(r.CurrentSigningKey, opts)
+	if r.KeyProvider != nil {
+		return verifyWithProvider(r.KeyProvider, opts)
+	}
+	return verifyWithKeys(SigningKeys{Current: r.CurrentSigningKey, Next: r.NextSigningKey}, opts)
+}
+
+func verifyWithKeys(keys SigningKeys, opts VerifyOptions) (err error) {
+	err = verify(keys.Current, opts)
 	if errors.Is(err, ErrInvalidSignature) {
-		err = verify(r.NextSigningKey, opts)
+		err = verify(keys.Next, opts)
+	}
+	return
+}
+
+type VerifyRequestOptions struct {
+	// BaseUrl is the public address the requests are received at. When it is set, the signature is also checked
+	// against the url of the request, which is the base url followed by the request path.
+	BaseUrl string
+	// Tolerance is the duration to tolerate when checking the signature, see VerifyOptions.
+	Tolerance time.Duration
+}
+
+// VerifyRequest verifies the signature of a request from its parts, for the frameworks that do not use net/http requests.
+// The requestURI is the path and the query of the request, it is only used when the base url is set.
+func (r *Receiver) VerifyRequest(signature string, body []byte, requestURI string, opts VerifyRequestOptions) error {
+	if signature == "" {
+		return fmt.Errorf("%w: missing %s header", ErrInvalidSignature, upstashSignatureHeader)
+	}
+	verifyOpts := VerifyOptions{
+		Signature: signature,
+		Body:      string(body),
+		Tolerance: opts.Tolerance,
+	}
+	base := strings.TrimSuffix(opts.BaseUrl, "/")
+	if base != "" {
+		verifyOpts.Url = base + requestURI
 	}
+	err := r.Verify(verifyOpts)
+	if err != nil && base != "" && (requestURI == "/" || requestURI == "") {
+		// A destination without a path is requested at the root path.
+		verifyOpts.Url = base
+		err = r.Verify(verifyOpts)
+	}
+	return err
+}
+
+// VerifyHTTPRequest reads the body of a request and verifies its signature.
+// The body of the request is replaced, so that it can be read again by the next handlers.
+func (r *Receiver) VerifyHTTPRequest(req *http.Request, opts VerifyRequestOptions) (body []byte, err error) {
+	body, err = io.ReadAll(req.Body)
+	if err != nil {
+		return
+	}
+	req.Body = io.NopCloser(bytes.NewReader(body))
+	err = r.VerifyRequest(req.Header.Get(upstashSignatureHeader), body, req.URL.RequestURI(), opts)
 	return
 }
+
+// Middleware returns a middleware that rejects the requests with an invalid signature with 401 Unauthorized.
+func (r *Receiver) Middleware(opts VerifyRequestOptions) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			if _, err := r.VerifyHTTPRequest(req, opts); err != nil {
+				http.Error(w, err.Error(), http.StatusUnauthorized)
+				return
+			}
+			next.ServeHTTP(w, req)
+		})
+	}
+}
@@ -0,0 +1,186 @@
+package qstash
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+)
+
+const (
+	// StatusNonRetryable is the status code that tells QStash not to retry a message.
+	StatusNonRetryable = 489
+	nonRetryableHeader = "Upstash-NonRetryable-Error"
+)
+
+var (
+	ErrDoNotRetry = fmt.Errorf("do not retry")
+)
+
+type doNotRetryError struct {
+	err error
+}
+
+func (e *doNotRetryError) Error() string {
+	if e.err == nil {
+		return ErrDoNotRetry.Error()
+	}
+	return e.err.Error()
+}
+
+func (e *doNotRetryError) Unwrap() []error {
+	if e.err == nil {
+		return []error{ErrDoNotRetry}
+	}
+	return []error{e.err, ErrDoNotRetry}
+}
+
+// DoNotRetry marks an error returned by a handler as permanent, so that QStash does not retry the message.
+func DoNotRetry(err error) error {
+	return &doNotRetryError{err: err}
+}
+
+// StatusError is an error returned by a handler to respond with a specific status code.
+// A code that is not a valid HTTP status code responds with 500 Internal Server Error.
+type StatusError struct {
+	Code int
+	Err  error
+}
+
+func (e *StatusError) Error() string {
+	if e.Err == nil {
+		return fmt.Sprintf("status %d", e.Code)
+	}
+	return e.Err.Error()
+}
+
+func (e *StatusError) Unwrap() error {
+	return e.Err
+}
+
+// Delivery is a message delivered by QStash, with its body decoded.
+type Delivery[T any] struct {
+	DeliveryInfo
+	// Body is the decoded body of the message.
+	Body T
+	// RawBody is the body of the message as received.
+	RawBody []byte
+	// Header is the headers of the request.
+	Header http.Header
+}
+
+type RouterOptions struct {
+	// Receiver verifies the signature of the requests.
+	Receiver *Receiver
+	// BaseUrl is the public address the router is served at. When it is set, the signature of the requests is also checked
+	// against the url of their handler, which is the base url followed by the request path.
+	BaseUrl string
+	// Tolerance is the duration to tolerate when checking the signature, see VerifyOptions.
+	Tolerance time.Duration
+	// ExposeErrors writes the text of the errors returned by handlers in the response body, which QStash keeps with the failed deliveries.
+	// Only the status text is written by default, since errors may contain internal details.
+	ExposeErrors bool
+}
+
+// Router is an HTTP handler that verifies the messages delivered by QStash, decodes them and dispatches them by path.
+//
+// Handlers are registered with Handle and responses follow the conventions of QStash:
+// a nil error responds with 200 OK, an error wrapped with DoNotRetry or a body that can not be decoded
+// responds with 489 so that the message is not retried, a *StatusError responds with its code,
+// and other errors respond with 500 Internal Server Error so that the message is retried.
+type Router struct {
+	options RouterOptions
+	mux     *http.ServeMux
+}
+
+func NewRouter(options RouterOptions) *Router {
+	options.BaseUrl = strings.TrimSuffix(options.BaseUrl, "/")
+	return &Router{
+		options: options,
+		mux:     http.NewServeMux(),
+	}
+}
+
+// Handle registers the handler of the messages delivered to the given path, which is a http.ServeMux pattern.
+// The body of the messages is decoded as JSON into T, unless T is []byte or string.
+func Handle[T any](router *Router, path string, handler func(ctx context.Context, delivery Delivery[T]) error) {
+	router.mux.HandleFunc(path, func(w http.ResponseWriter, r *http.Request) {
+		body, err := io.ReadAll(r.Body)
+		if err != nil {
+			http.Error(w, "failed to read body", http.StatusBadRequest)
+			return
+		}
+		if err = router.verify(r, body); err != nil {
+			http.Error(w, err.Error(), http.StatusUnauthorized)
+			return
+		}
+		info, err := ParseDelivery(r)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		delivery := Delivery[T]{
+			DeliveryInfo: info,
+			RawBody:      body,
+			Header:       r.Header,
+		}
+		if err = decodeBody(body, &delivery.Body); err != nil {
+			router.writeError(w, DoNotRetry(fmt.Errorf("failed to decode body: %w", err)))
+			return
+		}
+		if err = handler(r.Context(), delivery); err != nil {
+			router.writeError(w, err)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	})
+}
+
+func (r *Router) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	r.mux.ServeHTTP(w, req)
+}
+
+func (r *Router) verify(req *http.Request, body []byte) error {
+	return r.options.Receiver.VerifyRequest(req.Header.Get(upstashSignatureHeader), body, req.URL.RequestURI(), VerifyRequestOptions{
+		BaseUrl:   r.options.BaseUrl,
+		Tolerance: r.options.Tolerance,
+	})
+}
+
+func decodeBody[T any](body []byte, v *T) error {
+	switch b := any(v).(type) {
+	case *[]byte:
+		*b = body
+	case *string:
+		*b = string(body)
+	default:
+		return json.Unmarshal(body, v)
+	}
+	return nil
+}
+
+// writeError responds to QStash with the status code matching the error returned by a handler.
+func (r *Router) writeError(w http.ResponseWriter, err error) {
+	var sErr *StatusError
+	code := http.StatusInternalServerError
+	switch {
+	case errors.Is(err, ErrDoNotRetry):
+		w.Header().Set(nonRetryableHeader, "true")
+		code = StatusNonRetryable
+	case errors.As(err, &sErr) && sErr.Code >= 100 && sErr.Code <= 999:
+		// Other codes make WriteHeader panic, so they respond with 500 like the other errors.
+		code = sErr.Code
+	}
+	text := http.StatusText(code)
+	switch {
+	case r.options.ExposeErrors:
+		text = err.Error()
+	case code == StatusNonRetryable:
+		text = "Non-Retryable Error"
+	}
+	http.Error(w, text, code)
+}
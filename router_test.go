@@ -0,0 +1,137 @@
+package qstash
+
+import (
+	"context"
+	"fmt"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+type order struct {
+	Id     string `json:"id"`
+	Amount int    `json:"amount"`
+}
+
+func TestRouter(t *testing.T) {
+	key := "test-key"
+	router := NewRouter(RouterOptions{Receiver: NewReceiver(key, key)})
+
+	var deliveries []Delivery[order]
+	Handle(router, "/orders", func(ctx context.Context, delivery Delivery[order]) error {
+		deliveries = append(deliveries, delivery)
+		switch delivery.Body.Id {
+		case "invalid":
+			return DoNotRetry(fmt.Errorf("invalid order"))
+		case "conflict":
+			return &StatusError{Code: http.StatusConflict, Err: fmt.Errorf("already paid")}
+		case "later":
+			return fmt.Errorf("database is down")
+		}
+		return nil
+	})
+	var raw string
+	Handle(router, "/raw", func(ctx context.Context, delivery Delivery[string]) error {
+		raw = delivery.Body
+		return nil
+	})
+
+	send := func(path string, body string, signingKey string) *httptest.ResponseRecorder {
+		signature, err := sign(body, signingKey)
+		assert.NoError(t, err)
+		r := httptest.NewRequest(http.MethodPost, path, strings.NewReader(body))
+		r.Header.Set("Upstash-Signature", signature)
+		r.Header.Set("Upstash-Message-Id", "msg_1")
+		r.Header.Set("Upstash-Retried", "2")
+		r.Header.Set("Upstash-Queue-Name", "orders")
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, r)
+		return w
+	}
+
+	w := send("/orders", `{"id": "1", "amount": 10}`, key)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Len(t, deliveries, 1)
+	assert.Equal(t, order{Id: "1", Amount: 10}, deliveries[0].Body)
+	assert.Equal(t, "msg_1", deliveries[0].MessageId)
+	assert.Equal(t, 2, deliveries[0].Retried)
+	assert.Equal(t, "orders", deliveries[0].Queue)
+
+	w = send("/orders", `{"id": "invalid"}`, key)
+	assert.Equal(t, StatusNonRetryable, w.Code)
+	assert.Equal(t, "true", w.Header().Get("Upstash-NonRetryable-Error"))
+
+	w = send("/orders", `{"id": "conflict"}`, key)
+	assert.Equal(t, http.StatusConflict, w.Code)
+
+	w = send("/orders", `{"id": "later"}`, key)
+	assert.Equal(t, http.StatusInternalServerError, w.Code)
+	assert.NotContains(t, w.Body.String(), "database is down")
+
+	w = send("/orders", `not json`, key)
+	assert.Equal(t, StatusNonRetryable, w.Code)
+
+	w = send("/orders", `{"id": "1"}`, "wrong-key")
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+	assert.Len(t, deliveries, 4)
+
+	w = send("/raw", `not json`, key)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "not json", raw)
+
+	w = send("/unknown", `{}`, key)
+	assert.Equal(t, http.StatusNotFound, w.Code)
+}
+
+func TestRouterBaseUrl(t *testing.T) {
+	key := "test-key"
+	for base, status := range map[string]int{"https://example.com": http.StatusOK, "https://example.net": http.StatusUnauthorized} {
+		router := NewRouter(RouterOptions{Receiver: NewReceiver(key, key), BaseUrl: base})
+		Handle(router, "/", func(ctx context.Context, delivery Delivery[[]byte]) error { return nil })
+
+		signature, err := sign("body", key)
+		assert.NoError(t, err)
+		r := httptest.NewRequest(http.MethodPost, "/", strings.NewReader("body"))
+		r.Header.Set("Upstash-Signature", signature)
+		r.Header.Set("Upstash-Message-Id", "msg_1")
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, r)
+		assert.Equal(t, status, w.Code, base)
+	}
+}
+
+func TestRouterErrors(t *testing.T) {
+	assert.ErrorIs(t, DoNotRetry(nil), ErrDoNotRetry)
+	assert.Equal(t, "do not retry", DoNotRetry(nil).Error())
+	assert.Equal(t, "status 409", (&StatusError{Code: http.StatusConflict}).Error())
+
+	key := "test-key"
+	router := NewRouter(RouterOptions{Receiver: NewReceiver(key, key), ExposeErrors: true})
+	Handle(router, "/", func(ctx context.Context, delivery Delivery[[]byte]) error {
+		return &StatusError{Code: http.StatusConflict, Err: fmt.Errorf("already paid")}
+	})
+
+	signature, err := sign("body", key)
+	assert.NoError(t, err)
+	r := httptest.NewRequest(http.MethodPost, "/", strings.NewReader("body"))
+	r.Header.Set("Upstash-Signature", signature)
+	r.Header.Set("Upstash-Message-Id", "msg_1")
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, r)
+	assert.Equal(t, http.StatusConflict, w.Code)
+	assert.Equal(t, "already paid\n", w.Body.String())
+
+	// A status error without a valid code responds with 500.
+	Handle(router, "/missing-code", func(ctx context.Context, delivery Delivery[[]byte]) error {
+		return &StatusError{Err: fmt.Errorf("no code")}
+	})
+	r = httptest.NewRequest(http.MethodPost, "/missing-code", strings.NewReader("body"))
+	r.Header.Set("Upstash-Signature", signature)
+	r.Header.Set("Upstash-Message-Id", "msg_1")
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, r)
+	assert.Equal(t, http.StatusInternalServerError, w.Code)
+	assert.Equal(t, "no code\n", w.Body.String())
+}
@@ -0,0 +1,553 @@
+package qstash
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const (
+	defaultCompensationQueue = "saga-compensations"
+	// maxSagaUpdateAttempts is the number of times an update of a saga is attempted, when other coordinators update it too.
+	maxSagaUpdateAttempts = 5
+)
+
+var (
+	ErrSagaConflict = fmt.Errorf("saga was updated concurrently")
+	// errSagaUnchanged is returned by the updates of a saga that have nothing to store.
+	errSagaUnchanged = fmt.Errorf("saga unchanged")
+)
+
+type SagaState string
+
+var (
+	// SagaRunning is the state of a saga whose steps are being published.
+	SagaRunning SagaState = "RUNNING"
+	// SagaCompleted is the state of a saga whose steps were all delivered.
+	SagaCompleted SagaState = "COMPLETED"
+	// SagaCompensating is the state of a saga with a failed step, whose compensations are being delivered.
+	SagaCompensating SagaState = "COMPENSATING"
+	// SagaCompensated is the state of a saga whose compensations were all delivered.
+	SagaCompensated SagaState = "COMPENSATED"
+	// SagaFailed is the state of a saga with a compensation that failed, which requires a manual intervention.
+	SagaFailed SagaState = "FAILED"
+)
+
+type SagaStepState string
+
+var (
+	SagaStepPending SagaStepState = "PENDING"
+	// SagaStepPublishing is the state of a step that was claimed by a coordinator, and is being published.
+	SagaStepPublishing   SagaStepState = "PUBLISHING"
+	SagaStepPublished    SagaStepState = "PUBLISHED"
+	SagaStepDelivered    SagaStepState = "DELIVERED"
+	SagaStepFailed       SagaStepState = "FAILED"
+	SagaStepCompensating SagaStepState = "COMPENSATING"
+	SagaStepCompensated  SagaStepState = "COMPENSATED"
+	// SagaStepCompensationFailed is the state of a step whose compensation failed.
+	SagaStepCompensationFailed SagaStepState = "COMPENSATION_FAILED"
+)
+
+// SagaStep is a step of a saga: a forward message, and the message that undoes it if a later step fails.
+type SagaStep struct {
+	Name       string
+	Forward    PublishOptions
+	Compensate PublishOptions
+}
+
+type SagaStepRecord struct {
+	Name  string        `json:"name"`
+	State SagaStepState `json:"state"`
+	// MessageId is the id of the forward message, once it is published.
+	MessageId string `json:"messageId,omitempty"`
+	// CompensationMessageId is the id of the compensation message, once it is enqueued.
+	CompensationMessageId string `json:"compensationMessageId,omitempty"`
+	// Error is the reason the forward or the compensation message failed.
+	Error string `json:"error,omitempty"`
+}
+
+// SagaRecord is the persisted state of a saga.
+type SagaRecord struct {
+	Id    string           `json:"id"`
+	Name  string           `json:"name"`
+	State SagaState        `json:"state"`
+	Steps []SagaStepRecord `json:"steps"`
+	// Current is the index of the step being delivered.
+	Current   int   `json:"current"`
+	CreatedAt int64 `json:"createdAt"`
+	UpdatedAt int64 `json:"updatedAt"`
+	// Version is the number of times the record was stored, see SagaStore.
+	Version int64 `json:"version"`
+}
+
+// Done reports whether the saga reached a final state.
+func (r SagaRecord) Done() bool {
+	return r.State == SagaCompleted || r.State == SagaCompensated || r.State == SagaFailed
+}
+
+// SagaStore persists the records of the sagas, and their steps.
+type SagaStore interface {
+	Get(ctx context.Context, id string) (record SagaRecord, steps []SagaStep, found bool, err error)
+	// Put stores the record with its version incremented, if the stored record has the same version,
+	// or if no record is stored and the version is 0. Otherwise, it returns ErrSagaConflict.
+	// This lets coordinators that share a store apply each transition of a saga once.
+	Put(ctx context.Context, record SagaRecord, steps []SagaStep) error
+}
+
+// MemorySagaStore keeps the sagas in memory, they are lost when the process exits.
+type MemorySagaStore struct {
+	mu    sync.Mutex
+	sagas map[string]memorySaga
+}
+
+type memorySaga struct {
+	record SagaRecord
+	steps  []SagaStep
+}
+
+func NewMemorySagaStore() *MemorySagaStore {
+	return &MemorySagaStore{sagas: map[string]memorySaga{}}
+}
+
+func (s *MemorySagaStore) Get(_ context.Context, id string) (SagaRecord, []SagaStep, bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	saga, ok := s.sagas[id]
+	saga.record.Steps = append([]SagaStepRecord(nil), saga.record.Steps...)
+	return saga.record, saga.steps, ok, nil
+}
+
+func (s *MemorySagaStore) Put(_ context.Context, record SagaRecord, steps []SagaStep) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.sagas[record.Id].record.Version != record.Version {
+		return ErrSagaConflict
+	}
+	record.Version++
+	record.Steps = append([]SagaStepRecord(nil), record.Steps...)
+	s.sagas[record.Id] = memorySaga{record: record, steps: steps}
+	return nil
+}
+
+type SagaOptions struct {
+	// CallbackUrl is the public address the coordinator is served at, which receives the callbacks of the steps.
+	CallbackUrl string
+	// Receiver verifies the signature of the callbacks, when it is set.
+	// The signature is checked against the scheme and host of CallbackUrl followed by the path and query of the request,
+	// so that a signed callback can not be replayed for another saga, step or outcome.
+	Receiver *Receiver
+	// Store persists the sagas, a MemorySagaStore by default.
+	Store SagaStore
+	// CompensationQueue is the queue the compensations are enqueued to, "saga-compensations" by default.
+	// The queue should have a parallelism of 1, so that the compensations are delivered in order.
+	CompensationQueue string
+	// OnChange is called when the state of a saga changes, if it is set.
+	OnChange func(record SagaRecord)
+}
+
+// SagaCoordinator runs sagas: transactions made of messages that are delivered one after the other,
+// where the failure of a step undoes the previous steps with their compensating messages.
+//
+// The coordinator is an HTTP handler, served at the callback url, that receives the callback and the failure callback
+// of every message. When a step is delivered, the next one is published. When a step fails after its retries,
+// the compensations of the delivered steps are enqueued in reverse order.
+//
+// Coordinators may share a store, in several replicas: every transition is stored before its messages are sent,
+// and the messages are sent with a deduplication id, so a callback that is delivered twice sends them once.
+type SagaCoordinator struct {
+	client  *Client
+	options SagaOptions
+	// baseUrl is the scheme and host of the callback url, the callbacks are verified against it.
+	baseUrl string
+}
+
+func NewSagaCoordinator(client *Client, options SagaOptions) *SagaCoordinator {
+	if options.Store == nil {
+		options.Store = NewMemorySagaStore()
+	}
+	if options.CompensationQueue == "" {
+		options.CompensationQueue = defaultCompensationQueue
+	}
+	c := &SagaCoordinator{client: client, options: options}
+	if u, err := url.Parse(options.CallbackUrl); err == nil && u.Host != "" {
+		c.baseUrl = u.Scheme + "://" + u.Host
+	}
+	return c
+}
+
+// SagaBuilder adds the steps of a saga before it is started.
+type SagaBuilder struct {
+	coordinator *SagaCoordinator
+	name        string
+	steps       []SagaStep
+}
+
+// Saga starts building a saga with the given name.
+func (c *SagaCoordinator) Saga(name string) *SagaBuilder {
+	return &SagaBuilder{coordinator: c, name: name}
+}
+
+// Step adds a step with its forward message, and the message that compensates it.
+// The destination of the messages must be set with Url or To, their callbacks are set by the coordinator.
+// Their deduplication id is set by the coordinator too, unless it is set.
+func (b *SagaBuilder) Step(name string, forward PublishOptions, compensate PublishOptions) *SagaBuilder {
+	b.steps = append(b.steps, SagaStep{Name: name, Forward: forward, Compensate: compensate})
+	return b
+}
+
+// Start persists the saga and publishes its first step.
+func (b *SagaBuilder) Start(ctx context.Context) (record SagaRecord, err error) {
+	if len(b.steps) == 0 {
+		err = fmt.Errorf("a saga must have at least one step")
+		return
+	}
+	if b.coordinator.options.CallbackUrl == "" {
+		err = fmt.Errorf("`CallbackUrl` must be provided to run sagas")
+		return
+	}
+	now := time.Now().UnixMilli()
+	record = SagaRecord{
+		Id:        newSagaId(),
+		Name:      b.name,
+		State:     SagaRunning,
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+	for _, step := range b.steps {
+		record.Steps = append(record.Steps, SagaStepRecord{Name: step.Name, State: SagaStepPending})
+	}
+	record.Steps[0].State = SagaStepPublishing
+	c := b.coordinator
+	if err = c.put(ctx, &record, b.steps); err != nil {
+		return
+	}
+	return c.drive(ctx, record, b.steps)
+}
+
+// Get returns the record of a saga.
+func (c *SagaCoordinator) Get(ctx context.Context, id string) (record SagaRecord, err error) {
+	record, _, found, err := c.options.Store.Get(ctx, id)
+	if err == nil && !found {
+		err = fmt.Errorf("saga %s not found", id)
+	}
+	return
+}
+
+// callbackUrl returns the callback url of a message of a saga.
+func (c *SagaCoordinator) callbackUrl(id string, step int, outcome string) string {
+	params := url.Values{}
+	params.Set("saga", id)
+	params.Set("step", strconv.Itoa(step))
+	params.Set("outcome", outcome)
+	separator := "?"
+	if u, err := url.Parse(c.options.CallbackUrl); err == nil && u.RawQuery != "" {
+		separator = "&"
+	}
+	return c.options.CallbackUrl + separator + params.Encode()
+}
+
+func (c *SagaCoordinator) put(ctx context.Context, record *SagaRecord, steps []SagaStep) error {
+	record.UpdatedAt = time.Now().UnixMilli()
+	if err := c.options.Store.Put(ctx, *record, steps); err != nil {
+		return err
+	}
+	record.Version++
+	if c.options.OnChange != nil {
+		c.options.OnChange(*record)
+	}
+	return nil
+}
+
+// update applies fn to the stored record of a saga and stores it, until it does not conflict with another update.
+// When fn returns errSagaUnchanged, nothing is stored.
+func (c *SagaCoordinator) update(ctx context.Context, id string, fn func(record *SagaRecord) error) (record SagaRecord, steps []SagaStep, err error) {
+	for attempt := 1; ; attempt++ {
+		var found bool
+		record, steps, found, err = c.options.Store.Get(ctx, id)
+		if err != nil {
+			return
+		}
+		if !found {
+			err = fmt.Errorf("saga %s not found", id)
+			return
+		}
+		if err = fn(&record); err != nil {
+			if errors.Is(err, errSagaUnchanged) {
+				err = nil
+			}
+			return
+		}
+		err = c.put(ctx, &record, steps)
+		if !errors.Is(err, ErrSagaConflict) || attempt == maxSagaUpdateAttempts {
+			return
+		}
+	}
+}
+
+// drive sends the messages that the stored transitions of a saga call for: the step being published,
+// and the compensations that are not enqueued yet. It returns the updated record.
+func (c *SagaCoordinator) drive(ctx context.Context, record SagaRecord, steps []SagaStep) (SagaRecord, error) {
+	switch record.State {
+	case SagaRunning:
+		if record.Steps[record.Current].State == SagaStepPublishing {
+			return c.publishStep(ctx, record, steps)
+		}
+	case SagaCompensating:
+		return c.compensate(ctx, record, steps)
+	}
+	return record, nil
+}
+
+// publishStep publishes the current step of a saga, and stores its message id.
+func (c *SagaCoordinator) publishStep(ctx context.Context, record SagaRecord, steps []SagaStep) (SagaRecord, error) {
+	index := record.Current
+	options := steps[index].Forward
+	options.Callback = c.callbackUrl(record.Id, index, "delivered")
+	options.FailureCallback = c.callbackUrl(record.Id, index, "failed")
+	if options.DeduplicationId == "" {
+		options.DeduplicationId = record.Id + "-forward-" + strconv.Itoa(index)
+	}
+	response, err := c.client.Publish(options)
+	if err != nil {
+		return record, fmt.Errorf("failed to publish step %q: %w", steps[index].Name, err)
+	}
+	record, _, err = c.update(ctx, record.Id, func(record *SagaRecord) error {
+		step := &record.Steps[index]
+		if step.MessageId != "" {
+			return errSagaUnchanged
+		}
+		step.MessageId = response.MessageId
+		// The step may already be delivered, if its callback was received before this update.
+		if step.State == SagaStepPublishing {
+			step.State = SagaStepPublished
+		}
+		return nil
+	})
+	return record, err
+}
+
+// compensate enqueues the compensations of the delivered steps, in reverse order.
+func (c *SagaCoordinator) compensate(ctx context.Context, record SagaRecord, steps []SagaStep) (SagaRecord, error) {
+	for i := record.Current - 1; i >= 0; i-- {
+		if record.Steps[i].State != SagaStepDelivered {
+			continue
+		}
+		options := steps[i].Compensate.enqueueOptions(c.options.CompensationQueue)
+		options.Callback = c.callbackUrl(record.Id, i, "compensated")
+		options.FailureCallback = c.callbackUrl(record.Id, i, "compensation-failed")
+		if options.DeduplicationId == "" {
+			options.DeduplicationId = record.Id + "-" + strconv.Itoa(i)
+		}
+		response, err := c.client.Enqueue(options)
+		if err != nil {
+			return record, fmt.Errorf("failed to enqueue the compensation of step %q: %w", record.Steps[i].Name, err)
+		}
+		// The progress is stored after every compensation, so that a retry does not enqueue them twice.
+		index := i
+		record, _, err = c.update(ctx, record.Id, func(record *SagaRecord) error {
+			step := &record.Steps[index]
+			if step.CompensationMessageId != "" {
+				return errSagaUnchanged
+			}
+			step.CompensationMessageId = response.MessageId
+			// The compensation may already be delivered, if its callback was received before this update.
+			if step.State == SagaStepDelivered {
+				step.State = SagaStepCompensating
+			}
+			return nil
+		})
+		if err != nil {
+			return record, err
+		}
+	}
+	return record, nil
+}
+
+// enqueueOptions returns the options to enqueue the message to a queue.
+func (m PublishOptions) enqueueOptions(queue string) EnqueueOptions {
+	return EnqueueOptions{
+		To:                        m.To,
+		Queue:                     queue,
+		Url:                       m.Url,
+		Api:                       m.Api,
+		Body:                      m.Body,
+		Method:                    m.Method,
+		ContentType:               m.ContentType,
+		Headers:                   m.Headers,
+		Retries:                   m.Retries,
+		Callback:                  m.Callback,
+		FailureCallback:           m.FailureCallback,
+		Delay:                     m.Delay,
+		NotBefore:                 m.NotBefore,
+		DeduplicationId:           m.DeduplicationId,
+		ContentBasedDeduplication: m.ContentBasedDeduplication,
+		Timeout:                   m.Timeout,
+	}
+}
+
+// settle updates the state of a compensating saga once all its compensations are delivered or one failed.
+func settle(record *SagaRecord) {
+	if record.State != SagaCompensating {
+		return
+	}
+	state := SagaCompensated
+	for i, step := range record.Steps {
+		switch {
+		case step.State == SagaStepCompensating, step.State == SagaStepDelivered && i < record.Current:
+			return
+		case step.State == SagaStepCompensationFailed:
+			state = SagaFailed
+		}
+	}
+	record.State = state
+}
+
+// transition applies the outcome of a message to the record of a saga.
+// Callbacks may be delivered more than once, the outcomes that do not apply to the record are ignored.
+func transition(record *SagaRecord, index int, outcome string, reason string) error {
+	if index < 0 || index >= len(record.Steps) {
+		return fmt.Errorf("saga %s has no step %d", record.Id, index)
+	}
+	step := &record.Steps[index]
+	forward := record.State == SagaRunning && index == record.Current &&
+		(step.State == SagaStepPublishing || step.State == SagaStepPublished)
+	switch outcome {
+	case "delivered":
+		if !forward {
+			return errSagaUnchanged
+		}
+		step.State = SagaStepDelivered
+		if index+1 < len(record.Steps) {
+			record.Current++
+			record.Steps[record.Current].State = SagaStepPublishing
+		} else {
+			record.State = SagaCompleted
+		}
+	case "failed":
+		if !forward {
+			return errSagaUnchanged
+		}
+		step.State = SagaStepFailed
+		step.Error = reason
+		record.State = SagaCompensating
+	case "compensated", "compensation-failed":
+		// The callback may be received before the state of the compensated step is updated.
+		compensating := step.State == SagaStepCompensating || step.State == SagaStepDelivered && index < record.Current
+		if record.State != SagaCompensating || !compensating {
+			return errSagaUnchanged
+		}
+		step.State = SagaStepCompensated
+		if outcome == "compensation-failed" {
+			step.State = SagaStepCompensationFailed
+			step.Error = reason
+		}
+	default:
+		return fmt.Errorf("unknown outcome %q", outcome)
+	}
+	settle(record)
+	return nil
+}
+
+// advance applies the outcome of a message of a saga, and sends the messages that follow from it.
+func (c *SagaCoordinator) advance(ctx context.Context, id string, index int, outcome string, reason string) (SagaRecord, error) {
+	record, steps, err := c.update(ctx, id, func(record *SagaRecord) error {
+		return transition(record, index, outcome, reason)
+	})
+	if err != nil {
+		return record, err
+	}
+	// The messages are sent even if the outcome was already applied,
+	// in case the coordinator that applied it failed before sending them.
+	return c.drive(ctx, record, steps)
+}
+
+// Reconcile checks the events of the current step of a running saga, and applies its outcome.
+// It recovers the sagas whose callback was lost, and is a no-op for the other sagas.
+func (c *SagaCoordinator) Reconcile(ctx context.Context, id string) (record SagaRecord, err error) {
+	record, steps, found, err := c.options.Store.Get(ctx, id)
+	if err != nil {
+		return
+	}
+	if !found {
+		err = fmt.Errorf("saga %s not found", id)
+		return
+	}
+	if record.State != SagaRunning {
+		return
+	}
+	step := record.Steps[record.Current]
+	if step.State == SagaStepPublishing {
+		return c.drive(ctx, record, steps)
+	}
+	if step.State != SagaStepPublished {
+		return
+	}
+	state, reason, err := c.client.Events().latest(step.MessageId)
+	if err != nil {
+		return
+	}
+	switch state {
+	case Delivered:
+		return c.advance(ctx, id, record.Current, "delivered", "")
+	case Failed:
+		return c.advance(ctx, id, record.Current, "failed", reason)
+	}
+	return
+}
+
+func (c *SagaCoordinator) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		http.Error(w, "failed to read body", http.StatusBadRequest)
+		return
+	}
+	if c.options.Receiver != nil {
+		err = c.options.Receiver.VerifyRequest(r.Header.Get(upstashSignatureHeader), body, r.URL.RequestURI(), VerifyRequestOptions{
+			BaseUrl: c.baseUrl,
+		})
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusUnauthorized)
+			return
+		}
+	}
+	payload, err := ParseCallbackPayload(body)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("invalid callback payload: %v", err), http.StatusBadRequest)
+		return
+	}
+	query := r.URL.Query()
+	index, err := strconv.Atoi(query.Get("step"))
+	if err != nil {
+		http.Error(w, "invalid step", http.StatusBadRequest)
+		return
+	}
+	outcome := query.Get("outcome")
+	reason := ""
+	if !payload.Succeeded() {
+		if outcome == "delivered" || outcome == "compensated" {
+			// The callback describes an attempt that failed, the failure callback follows once the retries are exhausted.
+			w.WriteHeader(http.StatusOK)
+			return
+		}
+		reason = fmt.Sprintf("%d %s", payload.Status, payload.Body)
+	}
+	if _, err = c.advance(r.Context(), query.Get("saga"), index, outcome, reason); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+}
+
+func newSagaId() string {
+	b := make([]byte, 12)
+	_, _ = rand.Read(b)
+	return "saga_" + hex.EncodeToString(b)
+}
@@ -0,0 +1,258 @@
+package qstash_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/upstash/qstash-go"
+	"github.com/upstash/qstash-go/dev"
+)
+
+// sagaEnv runs a coordinator against a development server, with endpoints for the steps of the sagas.
+type sagaEnv struct {
+	server      *dev.Server
+	client      *qstash.Client
+	coordinator *qstash.SagaCoordinator
+	url         string
+
+	mu        sync.Mutex
+	hits      []string
+	failing   map[string]bool
+	callbacks []*http.Request
+	bodies    [][]byte
+	// drop makes the coordinator endpoint answer the callbacks without applying them.
+	drop bool
+}
+
+func newSagaEnv(t *testing.T) *sagaEnv {
+	server := dev.New(dev.Options{RetryBackoff: func(int) time.Duration { return 10 * time.Millisecond }})
+	assert.NoError(t, server.Start())
+	t.Cleanup(func() {
+		_ = server.Close()
+	})
+	env := &sagaEnv{server: server, client: server.Client(), failing: map[string]bool{}}
+	target := httptest.NewServer(nil)
+	t.Cleanup(target.Close)
+	env.url = target.URL
+	env.coordinator = qstash.NewSagaCoordinator(env.client, qstash.SagaOptions{
+		CallbackUrl: target.URL + "/saga",
+		Receiver:    server.Receiver(),
+	})
+	mux := http.NewServeMux()
+	mux.HandleFunc("/saga", func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		env.mu.Lock()
+		env.callbacks = append(env.callbacks, r.Clone(context.Background()))
+		env.bodies = append(env.bodies, body)
+		drop := env.drop
+		env.mu.Unlock()
+		if drop {
+			return
+		}
+		r.Body = io.NopCloser(bytes.NewReader(body))
+		env.coordinator.ServeHTTP(w, r)
+	})
+	mux.HandleFunc("/steps/", func(w http.ResponseWriter, r *http.Request) {
+		name := strings.TrimPrefix(r.URL.Path, "/steps/")
+		env.mu.Lock()
+		env.hits = append(env.hits, name)
+		failing := env.failing[name]
+		env.mu.Unlock()
+		if failing {
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+	})
+	target.Config.Handler = mux
+	return env
+}
+
+// step returns the forward and the compensating message of a step, which are not retried.
+func (e *sagaEnv) step(name string) (qstash.PublishOptions, qstash.PublishOptions) {
+	retries := 0
+	return qstash.PublishOptions{Url: e.url + "/steps/" + name, Retries: &retries},
+		qstash.PublishOptions{Url: e.url + "/steps/undo-" + name, Retries: &retries}
+}
+
+func (e *sagaEnv) received() []string {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return append([]string(nil), e.hits...)
+}
+
+func (e *sagaEnv) await(t *testing.T, id string, state qstash.SagaState) qstash.SagaRecord {
+	var record qstash.SagaRecord
+	assert.Eventually(t, func() bool {
+		var err error
+		record, err = e.coordinator.Get(context.Background(), id)
+		return err == nil && record.State == state
+	}, 5*time.Second, 10*time.Millisecond)
+	return record
+}
+
+func TestSaga(t *testing.T) {
+	env := newSagaEnv(t)
+	env.failing["ship"] = true
+	err := env.client.Queues().Upsert(qstash.Queue{Name: "saga-compensations", Parallelism: 1})
+	assert.NoError(t, err)
+
+	builder := env.coordinator.Saga("order")
+	for _, name := range []string{"reserve", "charge", "ship"} {
+		forward, compensate := env.step(name)
+		builder.Step(name, forward, compensate)
+	}
+	record, err := builder.Start(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, qstash.SagaRunning, record.State)
+	assert.NotEmpty(t, record.Steps[0].MessageId)
+
+	// The compensations of the delivered steps are delivered in reverse order.
+	record = env.await(t, record.Id, qstash.SagaCompensated)
+	assert.True(t, record.Done())
+	assert.Equal(t, []string{"reserve", "charge", "ship", "undo-charge", "undo-reserve"}, env.received())
+	assert.Equal(t, qstash.SagaStepCompensated, record.Steps[0].State)
+	assert.Equal(t, qstash.SagaStepCompensated, record.Steps[1].State)
+	assert.Equal(t, qstash.SagaStepFailed, record.Steps[2].State)
+	assert.Contains(t, record.Steps[2].Error, "500")
+}
+
+func TestSagaCompleted(t *testing.T) {
+	env := newSagaEnv(t)
+	builder := env.coordinator.Saga("order")
+	for _, name := range []string{"reserve", "charge"} {
+		forward, compensate := env.step(name)
+		builder.Step(name, forward, compensate)
+	}
+	record, err := builder.Start(context.Background())
+	assert.NoError(t, err)
+
+	record = env.await(t, record.Id, qstash.SagaCompleted)
+	assert.Equal(t, qstash.SagaStepDelivered, record.Steps[1].State)
+	assert.Equal(t, []string{"reserve", "charge"}, env.received())
+
+	// A duplicate callback does not publish the next step again.
+	env.mu.Lock()
+	callback, body := env.callbacks[0], env.bodies[0]
+	env.mu.Unlock()
+	_, err = env.client.Publish(qstash.PublishOptions{Url: env.url + callback.URL.RequestURI(), Body: string(body)})
+	assert.NoError(t, err)
+	time.Sleep(100 * time.Millisecond)
+	assert.Equal(t, []string{"reserve", "charge"}, env.received())
+}
+
+func TestSagaCallbacks(t *testing.T) {
+	env := newSagaEnv(t)
+	env.drop = true
+	forward, compensate := env.step("reserve")
+	record, err := env.coordinator.Saga("single").Step("reserve", forward, compensate).Start(context.Background())
+	assert.NoError(t, err)
+	assert.Eventually(t, func() bool {
+		env.mu.Lock()
+		defer env.mu.Unlock()
+		return len(env.callbacks) == 1
+	}, 5*time.Second, 10*time.Millisecond)
+
+	// A signed callback can not be replayed for another outcome.
+	env.mu.Lock()
+	callback, body := env.callbacks[0], env.bodies[0]
+	env.mu.Unlock()
+	replay := httptest.NewRequest(http.MethodPost, strings.Replace(callback.URL.RequestURI(), "delivered", "failed", 1), bytes.NewReader(body))
+	replay.Header = callback.Header.Clone()
+	w := httptest.NewRecorder()
+	env.coordinator.ServeHTTP(w, replay)
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+
+	// The callback of an attempt that failed does not deliver the step.
+	env.mu.Lock()
+	env.drop = false
+	env.mu.Unlock()
+	failed, err := json.Marshal(qstash.CallbackPayload{Status: http.StatusInternalServerError})
+	assert.NoError(t, err)
+	_, err = env.client.Publish(qstash.PublishOptions{Url: env.url + callback.URL.RequestURI(), Body: string(failed)})
+	assert.NoError(t, err)
+	assert.Eventually(t, func() bool {
+		env.mu.Lock()
+		defer env.mu.Unlock()
+		return len(env.callbacks) == 2
+	}, 5*time.Second, 10*time.Millisecond)
+	record, err = env.coordinator.Get(context.Background(), record.Id)
+	assert.NoError(t, err)
+	assert.Equal(t, qstash.SagaRunning, record.State)
+
+	_, err = env.client.Publish(qstash.PublishOptions{Url: env.url + callback.URL.RequestURI(), Body: string(body)})
+	assert.NoError(t, err)
+	record = env.await(t, record.Id, qstash.SagaCompleted)
+	assert.Equal(t, qstash.SagaStepDelivered, record.Steps[0].State)
+}
+
+func TestSagaCompensationOptions(t *testing.T) {
+	env := newSagaEnv(t)
+	env.failing["charge"] = true
+	reserve, undo := env.step("reserve")
+	notBefore := time.Now().Add(time.Hour)
+	undo.NotBefore = qstash.FormatNotBefore(notBefore)
+	undo.Headers = map[string]string{"Reason": "refund"}
+	charge, undoCharge := env.step("charge")
+	record, err := env.coordinator.Saga("order").
+		Step("reserve", reserve, undo).
+		Step("charge", charge, undoCharge).
+		Start(context.Background())
+	assert.NoError(t, err)
+
+	assert.Eventually(t, func() bool {
+		record, err = env.coordinator.Get(context.Background(), record.Id)
+		return err == nil && record.Steps[0].State == qstash.SagaStepCompensating
+	}, 5*time.Second, 10*time.Millisecond)
+	assert.Equal(t, qstash.SagaCompensating, record.State)
+	message, err := env.client.Messages().Get(record.Steps[0].CompensationMessageId)
+	assert.NoError(t, err)
+	assert.Equal(t, notBefore.Unix()*1000, message.NotBefore)
+	assert.Equal(t, "saga-compensations", message.Queue)
+	assert.Equal(t, "refund", message.Header.Get("Reason"))
+}
+
+func TestSagaReconcile(t *testing.T) {
+	env := newSagaEnv(t)
+	env.drop = true
+	forward, compensate := env.step("notify")
+	record, err := env.coordinator.Saga("single").Step("notify", forward, compensate).Start(context.Background())
+	assert.NoError(t, err)
+
+	record, err = env.coordinator.Reconcile(context.Background(), record.Id)
+	assert.NoError(t, err)
+	assert.Equal(t, qstash.SagaRunning, record.State)
+
+	// The callback is lost, the outcome is applied from the events of the step.
+	assert.Eventually(t, func() bool {
+		return len(env.received()) == 1
+	}, 5*time.Second, 10*time.Millisecond)
+	assert.Eventually(t, func() bool {
+		record, err = env.coordinator.Reconcile(context.Background(), record.Id)
+		return err == nil && record.State == qstash.SagaCompleted
+	}, 5*time.Second, 10*time.Millisecond)
+	assert.Equal(t, qstash.SagaStepDelivered, record.Steps[0].State)
+}
+
+func TestMemorySagaStoreConflict(t *testing.T) {
+	ctx := context.Background()
+	store := qstash.NewMemorySagaStore()
+	record := qstash.SagaRecord{Id: "saga", State: qstash.SagaRunning}
+	assert.NoError(t, store.Put(ctx, record, nil))
+	assert.ErrorIs(t, store.Put(ctx, record, nil), qstash.ErrSagaConflict)
+
+	stored, _, found, err := store.Get(ctx, "saga")
+	assert.NoError(t, err)
+	assert.True(t, found)
+	assert.Equal(t, int64(1), stored.Version)
+	stored.State = qstash.SagaCompleted
+	assert.NoError(t, store.Put(ctx, stored, nil))
+	assert.ErrorIs(t, store.Put(ctx, stored, nil), qstash.ErrSagaConflict)
+}
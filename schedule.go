@@ -4,6 +4,9 @@ import (
 	"encoding/json"
 	"fmt"
 	"net/http"
+	"time"
+
+	"github.com/upstash/qstash-go/cron"
 )
 
 // Schedules in QStash allow you to publish messages at specified intervals instead of just once.
@@ -20,8 +23,10 @@ type Schedule struct {
 	CreatedAt int64 `json:"createdAt"`
 	// Cron is the cron expression used to schedule the messages.
 	Cron string `json:"cron"`
-	// Destination is the destination url or url group.
+	// Destination is the destination url, url group or api, in the form of `api/<name>`.
 	Destination string `json:"destination"`
+	// QueueName is the name of the queue the messages are enqueued to, empty if they are published directly.
+	QueueName string `json:"queueName,omitempty"`
 	// Method is the HTTP method to use for the message.
 	Method string `json:"method"`
 	// Header is the headers of the message.
@@ -34,6 +39,8 @@ type Schedule struct {
 	Retries int32 `json:"retries"`
 	// Delay is the delay in seconds before the message is delivered.
 	Delay int32 `json:"delay,omitempty"`
+	// Timeout is the maximum duration of a delivery attempt in seconds, zero if the default timeout is used.
+	Timeout int32 `json:"timeout,omitempty"`
 	// Callback is the url which is called each time the message is attempted to be delivered.
 	Callback string `json:"callback,omitempty"`
 	// FailureCallback is the url which is called after the message is failed
@@ -50,15 +57,59 @@ type Schedule struct {
 	IsPaused bool `json:"isPaused,omitempty"`
 }
 
+// DestinationType returns whether the schedule sends its messages to an url, an url group or an api.
+func (s Schedule) DestinationType() DestinationType {
+	return s.Target().Type()
+}
+
+// CreationTime returns the creation time of the schedule.
+func (s Schedule) CreationTime() time.Time {
+	return fromUnixMilli(s.CreatedAt)
+}
+
+// LastScheduled returns the time of the last firing of the schedule, zero if it never fired.
+func (s Schedule) LastScheduled() time.Time {
+	return fromUnixMilli(s.LastScheduleTime)
+}
+
+// NextScheduled returns the time of the next firing of the schedule.
+func (s Schedule) NextScheduled() time.Time {
+	return fromUnixMilli(s.NextScheduleTime)
+}
+
+// DelayDuration returns the delay before the scheduled messages are delivered.
+func (s Schedule) DelayDuration() time.Duration {
+	return time.Duration(s.Delay) * time.Second
+}
+
+// LastStates returns the state of each message created by the last firing of the schedule, keyed by message id.
+func (s Schedule) LastStates() map[string]EventState {
+	states := make(map[string]EventState, len(s.LastScheduleStates))
+	for id, state := range s.LastScheduleStates {
+		states[id] = EventState(state)
+	}
+	return states
+}
+
 type scheduleResponse struct {
 	ScheduleId string `json:"scheduleId"`
 }
 
 // Create creates a schedule to send messages periodically and returns the ID of created schedule.
+// If ScheduleId is set and a schedule with that id exists, it is updated instead.
+// The cron expression is validated before sending the request, see cron.Parse for the supported syntax.
+// When NotBefore is set, the messages created by the schedule are not delivered before that time, which defers the start of the schedule.
 func (s *Schedules) Create(schedule ScheduleOptions) (string, error) {
+	if err := cron.Validate(schedule.Cron); err != nil {
+		return "", err
+	}
+	destination, err := schedule.destination()
+	if err != nil {
+		return "", err
+	}
 	opts := requestOptions{
 		method: http.MethodPost,
-		path:   fmt.Sprintf("/v2/Schedules/%s", schedule.Destination),
+		path:   fmt.Sprintf("/v2/schedules/%s", destination),
 		header: schedule.headers(),
 		body:   schedule.Body,
 	}
@@ -74,15 +125,23 @@ func (s *Schedules) Create(schedule ScheduleOptions) (string, error) {
 }
 
 // CreateJSON creates a schedule to send messages periodically,
+// or updates it if ScheduleId is set and a schedule with that id exists,
 // automatically serializing the body as JSON string, and setting content type to `application/json`.
 func (s *Schedules) CreateJSON(schedule ScheduleJSONOptions) (scheduleId string, err error) {
+	if err = cron.Validate(schedule.Cron); err != nil {
+		return
+	}
+	destination, err := schedule.destination()
+	if err != nil {
+		return
+	}
 	payload, err := json.Marshal(schedule.Body)
 	if err != nil {
 		return
 	}
 	opts := requestOptions{
 		method: http.MethodPost,
-		path:   fmt.Sprintf("/v2/schedules/%s", schedule.Destination),
+		path:   fmt.Sprintf("/v2/schedules/%s", destination),
 		header: schedule.headers(),
 		body:   string(payload),
 	}
@@ -97,11 +156,33 @@ func (s *Schedules) CreateJSON(schedule ScheduleJSONOptions) (scheduleId string,
 	return result.ScheduleId, err
 }
 
+// Update replaces the cron expression, destination, body, headers and delivery settings of an existing schedule,
+// keeping its id. If there is no schedule with the given id, it is created.
+func (s *Schedules) Update(scheduleId string, schedule ScheduleOptions) (err error) {
+	if scheduleId == "" {
+		return fmt.Errorf("`scheduleId` must be provided")
+	}
+	schedule.ScheduleId = scheduleId
+	_, err = s.Create(schedule)
+	return
+}
+
+// UpdateJSON replaces the cron expression, destination, body, headers and delivery settings of an existing schedule,
+// keeping its id, or creates it if there is no schedule with the given id. It automatically serializing the body as JSON string, and setting content type to `application/json`.
+func (s *Schedules) UpdateJSON(scheduleId string, schedule ScheduleJSONOptions) (err error) {
+	if scheduleId == "" {
+		return fmt.Errorf("`scheduleId` must be provided")
+	}
+	schedule.ScheduleId = scheduleId
+	_, err = s.CreateJSON(schedule)
+	return
+}
+
 // Get retrieves the schedule by its id.
 func (s *Schedules) Get(scheduleId string) (schedule Schedule, err error) {
 	opts := requestOptions{
 		method: http.MethodGet,
-		path:   fmt.Sprintf("/v2/Schedules/%s", scheduleId),
+		path:   fmt.Sprintf("/v2/schedules/%s", scheduleId),
 	}
 	response, _, err := s.client.fetchWith(opts)
 	if err != nil {
@@ -0,0 +1,196 @@
+package qstash
+
+import (
+	"context"
+	"sort"
+	"time"
+
+	"github.com/upstash/qstash-go/cron"
+)
+
+// firingWindow is the maximum time between the creation of messages that belong to the same firing of a schedule.
+const firingWindow = 5 * time.Second
+
+type ScheduleFiring struct {
+	// Time is the creation time of the first message of the firing.
+	Time time.Time
+	// Messages is the messages created by the firing, one per endpoint for url groups.
+	Messages []ScheduleFiringMessage
+}
+
+type ScheduleFiringMessage struct {
+	// MessageId is the id of the message.
+	MessageId string
+	// Url is the destination url of the message.
+	Url string
+	// State is the latest state of the message.
+	State EventState
+	// CreatedAt is the creation time of the message.
+	CreatedAt time.Time
+	// Latency is the duration between the creation of the message and its delivery or failure, zero if it is still in progress.
+	Latency time.Duration
+}
+
+// Failed reports whether any message of the firing failed.
+func (f ScheduleFiring) Failed() bool {
+	for _, m := range f.Messages {
+		if m.State == Failed {
+			return true
+		}
+	}
+	return false
+}
+
+// History retrieves the firings of a schedule since the given time, from the oldest to the newest.
+// It is built from the events of the messages created by the schedule, so it only covers the retention period of the events.
+func (s *Schedules) History(ctx context.Context, scheduleId string, since time.Time) ([]ScheduleFiring, error) {
+	var events []Event
+	options := ListEventsOptions{
+		Filter: EventFilter{
+			ScheduleId: scheduleId,
+			FromDate:   since,
+		},
+	}
+	for {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		page, cursor, err := s.client.Events().List(options)
+		if err != nil {
+			return nil, err
+		}
+		events = append(events, page...)
+		if cursor == "" || len(page) == 0 {
+			break
+		}
+		options.Cursor = cursor
+	}
+	return firings(events), nil
+}
+
+// firings groups the events of a schedule by message, and the messages by firing.
+func firings(events []Event) []ScheduleFiring {
+	messages := map[string]*ScheduleFiringMessage{}
+	latest := map[string]int64{}
+	for _, e := range events {
+		m, ok := messages[e.MessageId]
+		if !ok {
+			m = &ScheduleFiringMessage{MessageId: e.MessageId, Url: e.Url}
+			messages[e.MessageId] = m
+		}
+		if e.supersedes(latest[e.MessageId], m.State) {
+			latest[e.MessageId] = e.Time
+			m.State = e.State
+		}
+		if e.State == Created {
+			m.CreatedAt = e.Timestamp()
+		}
+	}
+	sorted := make([]ScheduleFiringMessage, 0, len(messages))
+	for id, m := range messages {
+		if m.CreatedAt.IsZero() {
+			// The creation happened before the requested period, so the firing is incomplete.
+			continue
+		}
+		if m.State == Delivered || m.State == Failed || m.State == Canceled {
+			m.Latency = time.UnixMilli(latest[id]).Sub(m.CreatedAt)
+		}
+		sorted = append(sorted, *m)
+	}
+	sort.Slice(sorted, func(i, j int) bool {
+		if sorted[i].CreatedAt.Equal(sorted[j].CreatedAt) {
+			return sorted[i].MessageId < sorted[j].MessageId
+		}
+		return sorted[i].CreatedAt.Before(sorted[j].CreatedAt)
+	})
+
+	var result []ScheduleFiring
+	for _, m := range sorted {
+		if len(result) == 0 || m.CreatedAt.Sub(result[len(result)-1].Time) > firingWindow {
+			result = append(result, ScheduleFiring{Time: m.CreatedAt})
+		}
+		last := &result[len(result)-1]
+		last.Messages = append(last.Messages, m)
+	}
+	return result
+}
+
+type ScheduleHealthOptions struct {
+	// Window is how far back the firings are inspected, 24 hours by default.
+	Window time.Duration
+	// Grace is how late a firing can be before it is considered missed, one minute by default.
+	Grace time.Duration
+}
+
+type ScheduleHealth struct {
+	// Schedule is the inspected schedule.
+	Schedule Schedule
+	// Firings is the number of firings within the window.
+	Firings int
+	// FailedFirings is the number of firings within the window that have at least one failed message.
+	FailedFirings int
+	// MissedFireTime is the earliest expected fire time that passed without the schedule firing, zero otherwise.
+	MissedFireTime time.Time
+}
+
+// Healthy reports whether the schedule fired on time and none of its recent firings failed.
+func (h ScheduleHealth) Healthy() bool {
+	return h.FailedFirings == 0 && h.MissedFireTime.IsZero()
+}
+
+// Health inspects the recent firings of all schedules that are not paused.
+// A schedule is flagged when any of its firings within the window failed,
+// or when its cron expression expected a firing since the last one that did not happen.
+func (s *Schedules) Health(ctx context.Context, options ScheduleHealthOptions) ([]ScheduleHealth, error) {
+	if options.Window <= 0 {
+		options.Window = 24 * time.Hour
+	}
+	if options.Grace <= 0 {
+		options.Grace = time.Minute
+	}
+	schedules, err := s.List()
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	var result []ScheduleHealth
+	for _, schedule := range schedules {
+		if schedule.IsPaused {
+			continue
+		}
+		history, err := s.History(ctx, schedule.Id, now.Add(-options.Window))
+		if err != nil {
+			return nil, err
+		}
+		health := ScheduleHealth{
+			Schedule:       schedule,
+			Firings:        len(history),
+			MissedFireTime: missedFireTime(schedule, now, options.Grace),
+		}
+		for _, firing := range history {
+			if firing.Failed() {
+				health.FailedFirings++
+			}
+		}
+		result = append(result, health)
+	}
+	return result, nil
+}
+
+// missedFireTime returns the first fire time expected by the cron expression after the last firing,
+// or after the creation if the schedule never fired, when it is older than the grace period.
+func missedFireTime(schedule Schedule, now time.Time, grace time.Duration) time.Time {
+	parsed, err := cron.Parse(schedule.Cron)
+	if err != nil {
+		return time.Time{}
+	}
+	last := schedule.LastScheduled()
+	if last.IsZero() {
+		last = schedule.CreationTime()
+	}
+	expected := parsed.Next(last)
+	if expected.IsZero() || expected.After(now.Add(-grace)) {
+		return time.Time{}
+	}
+	return expected
+}
@@ -0,0 +1,95 @@
+package qstash
+
+import (
+	"context"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func TestFirings(t *testing.T) {
+	base := time.Date(2024, time.January, 1, 0, 0, 0, 0, time.UTC).UnixMilli()
+	minute := time.Minute.Milliseconds()
+
+	// Events are listed from the newest to the oldest.
+	result := firings([]Event{
+		{Time: base + minute + 300, MessageId: "msg_3", State: Failed, Url: "https://example.com"},
+		{Time: base + minute + 100, MessageId: "msg_3", State: Active, Url: "https://example.com"},
+		{Time: base + minute, MessageId: "msg_3", State: Created, Url: "https://example.com"},
+		{Time: base + 500, MessageId: "msg_2", State: Delivered, Url: "https://example.net"},
+		{Time: base + 200, MessageId: "msg_1", State: Delivered, Url: "https://example.com"},
+		{Time: base + 10, MessageId: "msg_2", State: Created, Url: "https://example.net"},
+		{Time: base, MessageId: "msg_1", State: Created, Url: "https://example.com"},
+		{Time: base - 100, MessageId: "msg_0", State: Delivered, Url: "https://example.com"},
+	})
+
+	assert.Len(t, result, 2)
+	assert.Equal(t, time.UnixMilli(base), result[0].Time)
+	assert.Len(t, result[0].Messages, 2)
+	assert.Equal(t, "msg_1", result[0].Messages[0].MessageId)
+	assert.Equal(t, Delivered, result[0].Messages[0].State)
+	assert.Equal(t, 200*time.Millisecond, result[0].Messages[0].Latency)
+	assert.Equal(t, 490*time.Millisecond, result[0].Messages[1].Latency)
+	assert.False(t, result[0].Failed())
+
+	assert.Len(t, result[1].Messages, 1)
+	assert.Equal(t, Failed, result[1].Messages[0].State)
+	assert.True(t, result[1].Failed())
+
+	// An earlier event in the same millisecond does not replace the final state.
+	result = firings([]Event{
+		{Time: base + 100, MessageId: "msg_1", State: Delivered},
+		{Time: base + 100, MessageId: "msg_1", State: Active},
+		{Time: base, MessageId: "msg_1", State: Created},
+	})
+	assert.Len(t, result, 1)
+	assert.Equal(t, Delivered, result[0].Messages[0].State)
+	assert.Equal(t, 100*time.Millisecond, result[0].Messages[0].Latency)
+}
+
+func TestMissedFireTime(t *testing.T) {
+	now := time.Date(2024, time.January, 1, 12, 0, 30, 0, time.UTC)
+	schedule := Schedule{
+		Cron:             "0 * * * *",
+		CreatedAt:        now.Add(-3 * time.Hour).UnixMilli(),
+		LastScheduleTime: time.Date(2024, time.January, 1, 12, 0, 0, 0, time.UTC).UnixMilli(),
+	}
+	assert.True(t, missedFireTime(schedule, now, time.Minute).IsZero())
+
+	schedule.LastScheduleTime = time.Date(2024, time.January, 1, 11, 0, 0, 0, time.UTC).UnixMilli()
+	// The 12:00 firing is only 30 seconds late, which is within the grace period.
+	assert.True(t, missedFireTime(schedule, now, time.Minute).IsZero())
+	assert.WithinDuration(t, time.Date(2024, time.January, 1, 12, 0, 0, 0, time.UTC), missedFireTime(schedule, now, 10*time.Second), 0)
+
+	schedule.LastScheduleTime = 0
+	assert.WithinDuration(t, time.Date(2024, time.January, 1, 10, 0, 0, 0, time.UTC), missedFireTime(schedule, now, time.Minute), 0)
+}
+
+func TestScheduleHealth(t *testing.T) {
+	client := NewClientWithEnv()
+
+	scheduleId, err := client.Schedules().Create(ScheduleOptions{
+		Cron:        "1 1 1 1 1",
+		Destination: "https://example.com",
+	})
+	assert.NoError(t, err)
+
+	history, err := client.Schedules().History(context.Background(), scheduleId, time.Now().Add(-time.Hour))
+	assert.NoError(t, err)
+	assert.Empty(t, history)
+
+	health, err := client.Schedules().Health(context.Background(), ScheduleHealthOptions{})
+	assert.NoError(t, err)
+	found := false
+	for _, h := range health {
+		if h.Schedule.Id == scheduleId {
+			found = true
+			assert.True(t, h.Healthy())
+			assert.Zero(t, h.Firings)
+		}
+	}
+	assert.True(t, found)
+
+	err = client.Schedules().Delete(scheduleId)
+	assert.NoError(t, err)
+}
@@ -0,0 +1,427 @@
+package qstash
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/upstash/qstash-go/cron"
+	"gopkg.in/yaml.v3"
+)
+
+// scheduleKeyHeader is the forwarded header that ties a schedule to the key of its ScheduleSpec.
+const scheduleKeyHeader = "Qstash-Schedule-Key"
+
+// defaultScheduleRetries is the number of retries QStash uses when a schedule does not set them.
+const defaultScheduleRetries = 3
+
+// ScheduleSpec is the desired state of a schedule, used by Schedules.Sync.
+type ScheduleSpec struct {
+	// Key identifies the schedule across syncs, it must be unique among the specs.
+	// It is stored with the schedule and forwarded to the destination as the `Qstash-Schedule-Key` header.
+	Key string `json:"key" yaml:"key"`
+	// Destination is the url or url group the messages are sent to.
+	Destination string `json:"destination" yaml:"destination"`
+	// Queue is the name of the queue the messages are enqueued to, the messages are published directly when it is empty.
+	Queue string `json:"queue,omitempty" yaml:"queue,omitempty"`
+	// Cron is the cron expression used to schedule the messages.
+	Cron string `json:"cron" yaml:"cron"`
+	// Method is the HTTP method to use for the message, POST by default.
+	Method string `json:"method,omitempty" yaml:"method,omitempty"`
+	// ContentType is the content type of the body.
+	ContentType string `json:"contentType,omitempty" yaml:"contentType,omitempty"`
+	// Body is the body of the scheduled message.
+	Body string `json:"body,omitempty" yaml:"body,omitempty"`
+	// Headers is the headers forwarded to the destination.
+	Headers map[string]string `json:"headers,omitempty" yaml:"headers,omitempty"`
+	// Retries is the number of retries that should be attempted in case of delivery failure.
+	Retries *int `json:"retries,omitempty" yaml:"retries,omitempty"`
+	// Callback is the url which is called each time the message is attempted to be delivered.
+	Callback string `json:"callback,omitempty" yaml:"callback,omitempty"`
+	// FailureCallback is the url which is called after the message is failed.
+	FailureCallback string `json:"failureCallback,omitempty" yaml:"failureCallback,omitempty"`
+	// Delay is the delay before the message is delivered, such as 10s or 5m.
+	Delay string `json:"delay,omitempty" yaml:"delay,omitempty"`
+	// Timeout is the maximum duration of a delivery attempt, such as 10s.
+	Timeout string `json:"timeout,omitempty" yaml:"timeout,omitempty"`
+	// Paused indicates whether the schedule should be paused.
+	Paused bool `json:"paused,omitempty" yaml:"paused,omitempty"`
+}
+
+func (s ScheduleSpec) options() ScheduleOptions {
+	headers := make(map[string]string, len(s.Headers)+1)
+	for k, v := range s.Headers {
+		headers[k] = v
+	}
+	headers[scheduleKeyHeader] = s.Key
+	return ScheduleOptions{
+		Cron:            s.Cron,
+		ContentType:     s.ContentType,
+		Body:            s.Body,
+		Destination:     s.Destination,
+		Queue:           s.Queue,
+		Method:          s.Method,
+		Headers:         headers,
+		Retries:         s.Retries,
+		Callback:        s.Callback,
+		FailureCallback: s.FailureCallback,
+		Delay:           s.Delay,
+		Timeout:         s.Timeout,
+	}
+}
+
+// diff returns the names of the fields that differ between the spec and the existing schedule.
+func (s ScheduleSpec) diff(schedule Schedule) []string {
+	var changed []string
+	if s.Destination != schedule.Destination {
+		changed = append(changed, "destination")
+	}
+	if s.Queue != schedule.QueueName {
+		changed = append(changed, "queue")
+	}
+	if s.Cron != schedule.Cron {
+		changed = append(changed, "cron")
+	}
+	method := s.Method
+	if method == "" {
+		method = http.MethodPost
+	}
+	if !strings.EqualFold(method, schedule.Method) {
+		changed = append(changed, "method")
+	}
+	body := schedule.Body
+	if schedule.BodyBase64 != "" {
+		decoded, err := base64.StdEncoding.DecodeString(schedule.BodyBase64)
+		if err == nil {
+			body = string(decoded)
+		}
+	}
+	if s.Body != body {
+		changed = append(changed, "body")
+	}
+	if !reflect.DeepEqual(s.headers(), scheduleHeaders(schedule)) {
+		changed = append(changed, "headers")
+	}
+	retries := defaultScheduleRetries
+	if s.Retries != nil {
+		retries = *s.Retries
+	}
+	if int32(retries) != schedule.Retries {
+		changed = append(changed, "retries")
+	}
+	if s.Callback != schedule.Callback {
+		changed = append(changed, "callback")
+	}
+	if s.FailureCallback != schedule.FailureCallback {
+		changed = append(changed, "failureCallback")
+	}
+	if delay, err := parseDelaySeconds(s.Delay); err != nil || delay != schedule.Delay {
+		changed = append(changed, "delay")
+	}
+	if timeout, err := parseDelaySeconds(s.Timeout); err != nil || timeout != schedule.Timeout {
+		changed = append(changed, "timeout")
+	}
+	return changed
+}
+
+func (s ScheduleSpec) headers() map[string]string {
+	header := map[string]string{}
+	for k, v := range s.Headers {
+		if k = forwardedHeaderName(k); k != "" {
+			header[k] = v
+		}
+	}
+	if s.ContentType != "" {
+		header["Content-Type"] = s.ContentType
+	}
+	return header
+}
+
+// scheduleHeaders returns the headers of the schedule that are forwarded to the destination, without the key header.
+func scheduleHeaders(schedule Schedule) map[string]string {
+	header := map[string]string{}
+	for k, v := range schedule.Header {
+		k = forwardedHeaderName(k)
+		if k == "" || k == scheduleKeyHeader || len(v) == 0 {
+			continue
+		}
+		header[k] = v[0]
+	}
+	return header
+}
+
+func scheduleKey(schedule Schedule) string {
+	for k, v := range schedule.Header {
+		if forwardedHeaderName(k) == scheduleKeyHeader && len(v) > 0 {
+			return v[0]
+		}
+	}
+	return ""
+}
+
+// forwardedHeaderName returns the canonical name of a header as seen by the destination,
+// or an empty string for the Upstash-* headers that are not forwarded.
+func forwardedHeaderName(k string) string {
+	k = http.CanonicalHeaderKey(k)
+	if name, ok := strings.CutPrefix(k, upstashForwardHeader+"-"); ok {
+		return http.CanonicalHeaderKey(name)
+	}
+	if strings.HasPrefix(k, "Upstash-") {
+		return ""
+	}
+	return k
+}
+
+func parseDelaySeconds(delay string) (int32, error) {
+	if delay == "" {
+		return 0, nil
+	}
+	if days, ok := strings.CutSuffix(delay, "d"); ok {
+		n, err := strconv.Atoi(days)
+		if err != nil {
+			return 0, fmt.Errorf("invalid delay %q", delay)
+		}
+		return int32(n * 24 * 60 * 60), nil
+	}
+	d, err := time.ParseDuration(delay)
+	if err != nil {
+		return 0, fmt.Errorf("invalid delay %q", delay)
+	}
+	return int32(d / time.Second), nil
+}
+
+type ScheduleSyncAction string
+
+var (
+	ScheduleCreate ScheduleSyncAction = "create"
+	ScheduleUpdate ScheduleSyncAction = "update"
+	SchedulePause  ScheduleSyncAction = "pause"
+	ScheduleResume ScheduleSyncAction = "resume"
+	ScheduleDelete ScheduleSyncAction = "delete"
+)
+
+type ScheduleChange struct {
+	// Action is the change applied to the schedule.
+	Action ScheduleSyncAction
+	// Key is the key of the schedule.
+	Key string
+	// ScheduleId is the id of the existing schedule, or of the created schedule once the change is applied.
+	ScheduleId string
+	// Fields is the list of fields that caused an update.
+	Fields []string
+
+	// paused is whether the existing schedule is paused.
+	paused bool
+}
+
+// SchedulePlan is the list of changes needed to reach the desired schedules.
+type SchedulePlan struct {
+	Changes []ScheduleChange
+}
+
+// String formats the plan with one change per line.
+func (p SchedulePlan) String() string {
+	if len(p.Changes) == 0 {
+		return "no changes"
+	}
+	var b strings.Builder
+	for _, c := range p.Changes {
+		fmt.Fprintf(&b, "%-8s %s", c.Action, c.Key)
+		if c.ScheduleId != "" {
+			fmt.Fprintf(&b, " (%s)", c.ScheduleId)
+		}
+		if len(c.Fields) > 0 {
+			fmt.Fprintf(&b, ": %s changed", strings.Join(c.Fields, ", "))
+		}
+		b.WriteString("\n")
+	}
+	return b.String()
+}
+
+type SyncScheduleOptions struct {
+	// DryRun computes the plan without applying it.
+	DryRun bool
+	// KeepUnknown keeps the schedules that have a key but are not among the desired specs, they are deleted otherwise.
+	// Schedules without a key are never modified.
+	KeepUnknown bool
+	// KeyPrefix limits the sync to the schedules whose key starts with it, the other schedules are never modified.
+	// All the desired specs must have keys starting with it.
+	KeyPrefix string
+}
+
+// Sync reconciles the schedules with the desired specs, matching them by key.
+// Missing schedules are created, schedules whose cron, destination, body, headers or delivery settings changed are updated in place,
+// and schedules whose key is no longer desired are deleted.
+// It returns the plan, with the applied changes when the sync is not a dry run.
+func (s *Schedules) Sync(ctx context.Context, desired []ScheduleSpec, options SyncScheduleOptions) (plan SchedulePlan, err error) {
+	if err = validateScheduleSpecs(desired); err != nil {
+		return
+	}
+	for _, spec := range desired {
+		if !strings.HasPrefix(spec.Key, options.KeyPrefix) {
+			return plan, fmt.Errorf("schedule spec %s: key must start with %q", spec.Key, options.KeyPrefix)
+		}
+	}
+	schedules, err := s.List()
+	if err != nil {
+		return
+	}
+	existing := map[string]Schedule{}
+	var duplicates []Schedule
+	for _, schedule := range schedules {
+		key := scheduleKey(schedule)
+		if key == "" || !strings.HasPrefix(key, options.KeyPrefix) {
+			continue
+		}
+		if _, ok := existing[key]; ok {
+			duplicates = append(duplicates, schedule)
+			continue
+		}
+		existing[key] = schedule
+	}
+
+	wanted := map[string]bool{}
+	for _, spec := range desired {
+		wanted[spec.Key] = true
+		schedule, ok := existing[spec.Key]
+		switch {
+		case !ok:
+			plan.Changes = append(plan.Changes, ScheduleChange{Action: ScheduleCreate, Key: spec.Key})
+		case len(spec.diff(schedule)) > 0:
+			plan.Changes = append(plan.Changes, ScheduleChange{
+				Action:     ScheduleUpdate,
+				Key:        spec.Key,
+				ScheduleId: schedule.Id,
+				Fields:     spec.diff(schedule),
+				paused:     schedule.IsPaused,
+			})
+		case spec.Paused && !schedule.IsPaused:
+			plan.Changes = append(plan.Changes, ScheduleChange{Action: SchedulePause, Key: spec.Key, ScheduleId: schedule.Id})
+		case !spec.Paused && schedule.IsPaused:
+			plan.Changes = append(plan.Changes, ScheduleChange{Action: ScheduleResume, Key: spec.Key, ScheduleId: schedule.Id})
+		}
+	}
+	for _, schedule := range duplicates {
+		plan.Changes = append(plan.Changes, ScheduleChange{Action: ScheduleDelete, Key: scheduleKey(schedule), ScheduleId: schedule.Id})
+	}
+	if !options.KeepUnknown {
+		for _, schedule := range schedules {
+			key := scheduleKey(schedule)
+			if key != "" && strings.HasPrefix(key, options.KeyPrefix) && !wanted[key] && existing[key].Id == schedule.Id {
+				plan.Changes = append(plan.Changes, ScheduleChange{Action: ScheduleDelete, Key: key, ScheduleId: schedule.Id})
+			}
+		}
+	}
+	if options.DryRun {
+		return
+	}
+
+	specs := map[string]ScheduleSpec{}
+	for _, spec := range desired {
+		specs[spec.Key] = spec
+	}
+	for i, change := range plan.Changes {
+		if err = ctx.Err(); err != nil {
+			return
+		}
+		if err = s.apply(&plan.Changes[i], specs[change.Key]); err != nil {
+			return plan, fmt.Errorf("failed to %s schedule %s: %w", change.Action, change.Key, err)
+		}
+	}
+	return
+}
+
+func (s *Schedules) apply(change *ScheduleChange, spec ScheduleSpec) (err error) {
+	switch change.Action {
+	case ScheduleCreate:
+		if change.ScheduleId, err = s.Create(spec.options()); err != nil {
+			return
+		}
+		if spec.Paused {
+			err = s.Pause(change.ScheduleId)
+		}
+	case ScheduleUpdate:
+		if err = s.Update(change.ScheduleId, spec.options()); err != nil {
+			return
+		}
+		if spec.Paused && !change.paused {
+			err = s.Pause(change.ScheduleId)
+		} else if !spec.Paused && change.paused {
+			err = s.Resume(change.ScheduleId)
+		}
+	case SchedulePause:
+		err = s.Pause(change.ScheduleId)
+	case ScheduleResume:
+		err = s.Resume(change.ScheduleId)
+	case ScheduleDelete:
+		err = s.Delete(change.ScheduleId)
+	}
+	return
+}
+
+func validateScheduleSpecs(specs []ScheduleSpec) error {
+	keys := map[string]bool{}
+	for idx, spec := range specs {
+		if spec.Key == "" {
+			return fmt.Errorf("schedule spec at index %d: `key` must be provided", idx)
+		}
+		if keys[spec.Key] {
+			return fmt.Errorf("schedule spec %s: duplicate key", spec.Key)
+		}
+		keys[spec.Key] = true
+		if spec.Destination == "" {
+			return fmt.Errorf("schedule spec %s: `destination` must be provided", spec.Key)
+		}
+		if spec.Cron == "" {
+			return fmt.Errorf("schedule spec %s: `cron` must be provided", spec.Key)
+		}
+		if err := cron.Validate(spec.Cron); err != nil {
+			return fmt.Errorf("schedule spec %s: %w", spec.Key, err)
+		}
+		if _, err := parseDelaySeconds(spec.Delay); err != nil {
+			return fmt.Errorf("schedule spec %s: %w", spec.Key, err)
+		}
+		if _, err := parseDelaySeconds(spec.Timeout); err != nil {
+			return fmt.Errorf("schedule spec %s: invalid timeout %q", spec.Key, spec.Timeout)
+		}
+	}
+	return nil
+}
+
+// ParseScheduleSpecsJSON parses a JSON array of schedule specs.
+func ParseScheduleSpecsJSON(data []byte) (specs []ScheduleSpec, err error) {
+	if err = json.Unmarshal(data, &specs); err != nil {
+		return nil, err
+	}
+	return specs, validateScheduleSpecs(specs)
+}
+
+// ParseScheduleSpecsYAML parses a YAML sequence of schedule specs.
+func ParseScheduleSpecsYAML(data []byte) (specs []ScheduleSpec, err error) {
+	if err = yaml.Unmarshal(data, &specs); err != nil {
+		return nil, err
+	}
+	return specs, validateScheduleSpecs(specs)
+}
+
+// LoadScheduleSpecs reads schedule specs from a file, which is parsed as YAML if its extension is .yaml or .yml, and as JSON otherwise.
+func LoadScheduleSpecs(path string) ([]ScheduleSpec, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		return ParseScheduleSpecsYAML(data)
+	default:
+		return ParseScheduleSpecsJSON(data)
+	}
+}
@@ -0,0 +1,148 @@
+package qstash
+
+import (
+	"context"
+	"fmt"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func TestParseScheduleSpecs(t *testing.T) {
+	specs, err := ParseScheduleSpecsYAML([]byte(`
+- key: nightly-report
+  destination: https://example.com/report
+  cron: "0 0 * * *"
+  headers:
+    test-header: test-value
+  retries: 1
+- key: cleanup
+  destination: https://example.com/cleanup
+  cron: "*/5 * * * *"
+  paused: true
+`))
+	assert.NoError(t, err)
+	assert.Len(t, specs, 2)
+	assert.Equal(t, "nightly-report", specs[0].Key)
+	assert.Equal(t, "test-value", specs[0].Headers["test-header"])
+	assert.Equal(t, 1, *specs[0].Retries)
+	assert.True(t, specs[1].Paused)
+
+	specs, err = ParseScheduleSpecsJSON([]byte(`[{"key": "a", "destination": "https://example.com", "cron": "1 1 1 1 1"}]`))
+	assert.NoError(t, err)
+	assert.Len(t, specs, 1)
+
+	_, err = ParseScheduleSpecsJSON([]byte(`[{"key": "a", "destination": "https://example.com", "cron": "1 1 1 1 1"}, {"key": "a", "destination": "https://example.com", "cron": "1 1 1 1 1"}]`))
+	assert.ErrorContains(t, err, "duplicate key")
+
+	_, err = ParseScheduleSpecsJSON([]byte(`[{"key": "a", "destination": "https://example.com"}]`))
+	assert.ErrorContains(t, err, "`cron` must be provided")
+}
+
+func TestScheduleSpecDiff(t *testing.T) {
+	spec := ScheduleSpec{
+		Key:         "a",
+		Destination: "https://example.com",
+		Cron:        "1 1 1 1 1",
+		Body:        "test-body",
+		Headers:     map[string]string{"test-header": "test-value"},
+		Delay:       "1m",
+	}
+	schedule := Schedule{
+		Destination: "https://example.com",
+		Cron:        "1 1 1 1 1",
+		Method:      "POST",
+		Body:        "test-body",
+		Retries:     3,
+		Delay:       60,
+		Header: map[string][]string{
+			"Test-Header":         {"test-value"},
+			"Qstash-Schedule-Key": {"a"},
+		},
+	}
+	assert.Empty(t, spec.diff(schedule))
+	assert.Equal(t, "a", scheduleKey(schedule))
+
+	spec.Cron = "2 2 2 2 2"
+	spec.Headers["test-header"] = "other-value"
+	assert.Equal(t, []string{"cron", "headers"}, spec.diff(schedule))
+}
+
+func TestScheduleSpecDiffDeliverySettings(t *testing.T) {
+	spec := ScheduleSpec{Key: "a", Destination: "https://example.com", Cron: "1 1 1 1 1"}
+	schedule := Schedule{
+		Destination: "https://example.com",
+		Cron:        "1 1 1 1 1",
+		Method:      "POST",
+		Retries:     3,
+		Header:      map[string][]string{"Qstash-Schedule-Key": {"a"}},
+	}
+	assert.Empty(t, spec.diff(schedule))
+
+	spec.Timeout = "10s"
+	assert.Equal(t, []string{"timeout"}, spec.diff(schedule))
+	schedule.Timeout = 10
+	assert.Empty(t, spec.diff(schedule))
+
+	schedule.Retries = 5
+	assert.Equal(t, []string{"retries"}, spec.diff(schedule))
+	retries := 5
+	spec.Retries = &retries
+	assert.Empty(t, spec.diff(schedule))
+}
+
+func TestScheduleSync(t *testing.T) {
+	client := NewClientWithEnv()
+	ctx := context.Background()
+
+	// A unique prefix keeps the sync away from the other schedules of the account.
+	prefix := fmt.Sprintf("go-sync-%d-", time.Now().UnixNano())
+	options := SyncScheduleOptions{KeyPrefix: prefix}
+	desired := []ScheduleSpec{
+		{Key: prefix + "a", Destination: "https://example.com", Cron: "1 1 1 1 1", Body: "a"},
+		{Key: prefix + "b", Destination: "https://example.com", Cron: "1 1 1 1 1", Body: "b", Paused: true},
+	}
+
+	_, err := client.Schedules().Sync(ctx, []ScheduleSpec{{Key: "other", Destination: "https://example.com", Cron: "1 1 1 1 1"}}, options)
+	assert.ErrorContains(t, err, "key must start with")
+
+	plan, err := client.Schedules().Sync(ctx, desired, SyncScheduleOptions{DryRun: true, KeyPrefix: prefix})
+	assert.NoError(t, err)
+	assert.Len(t, plan.Changes, 2)
+	assert.Equal(t, ScheduleCreate, plan.Changes[0].Action)
+	assert.Empty(t, plan.Changes[0].ScheduleId)
+
+	plan, err = client.Schedules().Sync(ctx, desired, options)
+	assert.NoError(t, err)
+	assert.Len(t, plan.Changes, 2)
+	assert.NotEmpty(t, plan.Changes[1].ScheduleId)
+	scheduleId := plan.Changes[0].ScheduleId
+
+	schedule, err := client.Schedules().Get(plan.Changes[1].ScheduleId)
+	assert.NoError(t, err)
+	assert.True(t, schedule.IsPaused)
+
+	plan, err = client.Schedules().Sync(ctx, desired, options)
+	assert.NoError(t, err)
+	assert.Empty(t, plan.Changes)
+
+	desired[0].Cron = "2 2 2 2 2"
+	desired = desired[:1]
+	plan, err = client.Schedules().Sync(ctx, desired, options)
+	assert.NoError(t, err)
+	assert.Len(t, plan.Changes, 2)
+	assert.Equal(t, ScheduleUpdate, plan.Changes[0].Action)
+	assert.Equal(t, []string{"cron"}, plan.Changes[0].Fields)
+	assert.Equal(t, scheduleId, plan.Changes[0].ScheduleId)
+	assert.Equal(t, ScheduleDelete, plan.Changes[1].Action)
+	assert.Equal(t, prefix+"b", plan.Changes[1].Key)
+
+	schedule, err = client.Schedules().Get(plan.Changes[0].ScheduleId)
+	assert.NoError(t, err)
+	assert.Equal(t, "2 2 2 2 2", schedule.Cron)
+
+	plan, err = client.Schedules().Sync(ctx, nil, options)
+	assert.NoError(t, err)
+	assert.Len(t, plan.Changes, 1)
+	assert.Equal(t, ScheduleDelete, plan.Changes[0].Action)
+}
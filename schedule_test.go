@@ -1,8 +1,11 @@
 package qstash
 
 import (
+	"errors"
 	"github.com/stretchr/testify/assert"
+	"github.com/upstash/qstash-go/cron"
 	"testing"
+	"time"
 )
 
 func TestSchedule(t *testing.T) {
@@ -50,6 +53,25 @@ func TestSchedule(t *testing.T) {
 	assert.NotContains(t, schedules, scheduleId)
 }
 
+func TestScheduleTimes(t *testing.T) {
+	client := NewClientWithEnv()
+
+	scheduleId, err := client.Schedules().Create(ScheduleOptions{
+		Cron:        "1 1 1 1 1",
+		Destination: "https://example.com",
+	})
+	assert.NoError(t, err)
+
+	schedule, err := client.Schedules().Get(scheduleId)
+	assert.NoError(t, err)
+	assert.WithinDuration(t, time.Now(), schedule.CreationTime(), time.Minute)
+	assert.True(t, schedule.NextScheduled().After(time.Now()))
+	assert.True(t, schedule.LastScheduled().IsZero())
+
+	err = client.Schedules().Delete(scheduleId)
+	assert.NoError(t, err)
+}
+
 func TestSchedulePauseAndResume(t *testing.T) {
 	client := NewClientWithEnv()
 
@@ -93,3 +115,124 @@ func TestSchedulePauseAndResume(t *testing.T) {
 	err = client.Schedules().Delete(scheduleId)
 	assert.NoError(t, err)
 }
+
+func TestScheduleUpdate(t *testing.T) {
+	client := NewClientWithEnv()
+
+	scheduleId, err := client.Schedules().Create(ScheduleOptions{
+		Cron:        "1 1 1 1 1",
+		Destination: "https://example.com",
+		Body:        "test-body",
+	})
+	assert.NoError(t, err)
+	assert.NotEmpty(t, scheduleId)
+
+	err = client.Schedules().Update(scheduleId, ScheduleOptions{
+		Cron:        "2 2 2 2 2",
+		Destination: "https://example.net",
+		Body:        "updated-body",
+	})
+	assert.NoError(t, err)
+
+	schedule, err := client.Schedules().Get(scheduleId)
+	assert.NoError(t, err)
+	assert.Equal(t, scheduleId, schedule.Id)
+	assert.Equal(t, "2 2 2 2 2", schedule.Cron)
+	assert.Equal(t, "https://example.net", schedule.Destination)
+	assert.Equal(t, "updated-body", schedule.Body)
+
+	// Create with an explicit id is an upsert.
+	created, err := client.Schedules().CreateJSON(ScheduleJSONOptions{
+		ScheduleId:  scheduleId,
+		Cron:        "3 3 3 3 3",
+		Destination: "https://example.com",
+		Body:        map[string]any{"ex_key": "ex_value"},
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, scheduleId, created)
+
+	schedule, err = client.Schedules().Get(scheduleId)
+	assert.NoError(t, err)
+	assert.Equal(t, "3 3 3 3 3", schedule.Cron)
+
+	err = client.Schedules().Delete(scheduleId)
+	assert.NoError(t, err)
+}
+
+func TestScheduleInvalidCron(t *testing.T) {
+	client := NewClient("test-token")
+
+	_, err := client.Schedules().Create(ScheduleOptions{
+		Cron:        "0 25 * * *",
+		Destination: "https://example.com",
+	})
+	var sErr *cron.SyntaxError
+	assert.True(t, errors.As(err, &sErr))
+	assert.Equal(t, 2, sErr.Pos)
+
+	_, err = client.Schedules().CreateJSON(ScheduleJSONOptions{
+		Cron:        "* * * *",
+		Destination: "https://example.com",
+	})
+	assert.ErrorContains(t, err, "expected 5 fields, found 4")
+}
+
+func TestScheduleDestinations(t *testing.T) {
+	client := NewClientWithEnv()
+
+	name := "go_url_group"
+	err := client.UrlGroups().UpsertEndpoints(name, []Endpoint{
+		{Url: "https://example.com", Name: "First endpoint"},
+	})
+	assert.NoError(t, err)
+
+	scheduleId, err := client.Schedules().Create(ScheduleOptions{
+		Cron:     "1 1 1 1 1",
+		UrlGroup: name,
+		Queue:    "test-queue",
+		Body:     "test-body",
+	})
+	assert.NoError(t, err)
+
+	schedule, err := client.Schedules().Get(scheduleId)
+	assert.NoError(t, err)
+	assert.Equal(t, name, schedule.Destination)
+	assert.Equal(t, DestinationUrlGroup, schedule.DestinationType())
+	assert.Equal(t, "test-queue", schedule.QueueName)
+
+	scheduleId2, err := client.Schedules().CreateJSON(ScheduleJSONOptions{
+		Cron: "1 1 1 1 1",
+		Url:  "https://example.com",
+		Body: map[string]any{"ex_key": "ex_value"},
+	})
+	assert.NoError(t, err)
+
+	schedule, err = client.Schedules().Get(scheduleId2)
+	assert.NoError(t, err)
+	assert.Equal(t, DestinationUrl, schedule.DestinationType())
+	assert.Empty(t, schedule.QueueName)
+
+	assert.NoError(t, client.Schedules().Delete(scheduleId))
+	assert.NoError(t, client.Schedules().Delete(scheduleId2))
+	assert.NoError(t, client.UrlGroups().Delete(name))
+}
+
+func TestScheduleMultipleDestinations(t *testing.T) {
+	client := NewClient("test-token")
+
+	_, err := client.Schedules().Create(ScheduleOptions{
+		Cron:        "1 1 1 1 1",
+		Destination: "https://example.com",
+		Url:         "https://example.com",
+	})
+	assert.ErrorContains(t, err, "multiple destinations found")
+
+	_, err = client.Schedules().CreateJSON(ScheduleJSONOptions{
+		Cron:     "1 1 1 1 1",
+		Url:      "https://example.com",
+		UrlGroup: "go_url_group",
+	})
+	assert.ErrorContains(t, err, "multiple destinations found")
+
+	assert.Equal(t, DestinationApi, Schedule{Destination: "api/llm"}.DestinationType())
+}
@@ -4,6 +4,7 @@ import (
 	"encoding/json"
 	"fmt"
 	"net/http"
+	"time"
 )
 
 // UrlGroups in QStash are namespaces where you can publish messages that are then sent to multiple endpoints.
@@ -31,6 +32,16 @@ type UrlGroup struct {
 	Endpoints []Endpoint `json:"endpoints"`
 }
 
+// CreationTime returns the creation time of the url group.
+func (u UrlGroup) CreationTime() time.Time {
+	return fromUnixMilli(u.CreatedAt)
+}
+
+// UpdateTime returns the last update time of the url group.
+func (u UrlGroup) UpdateTime() time.Time {
+	return fromUnixMilli(u.UpdatedAt)
+}
+
 // Publish publishes a message to QStash.
 func (u *UrlGroups) Publish(po PublishUrlGroupOptions) (result []PublishOrEnqueueResponse, err error) {
 	opts := requestOptions{
@@ -0,0 +1,173 @@
+package qstash
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+)
+
+type FanoutEndpointResult struct {
+	// Endpoint is the endpoint of the url group the message was sent to.
+	Endpoint Endpoint
+	// MessageId is the id of the message sent to the endpoint.
+	MessageId string
+	// State is the latest state of the message.
+	State EventState
+	// Error is the latest delivery error of the message, empty if there is none.
+	Error string
+}
+
+// Done reports whether the message was delivered, failed or canceled.
+func (r FanoutEndpointResult) Done() bool {
+	return r.State == Delivered || r.State == Failed || r.State == Canceled
+}
+
+// FanoutResult is the outcome of a message published or enqueued to an url group, per endpoint.
+type FanoutResult struct {
+	// UrlGroup is the name of the url group.
+	UrlGroup string
+	// Endpoints is the result of each endpoint, in the order of the publish responses.
+	Endpoints []FanoutEndpointResult
+}
+
+// Done reports whether the messages of all endpoints were delivered, failed or canceled.
+func (r FanoutResult) Done() bool {
+	for _, e := range r.Endpoints {
+		if !e.Done() {
+			return false
+		}
+	}
+	return true
+}
+
+// Failed returns the results of the endpoints whose message failed.
+func (r FanoutResult) Failed() []FanoutEndpointResult {
+	var failed []FanoutEndpointResult
+	for _, e := range r.Endpoints {
+		if e.State == Failed {
+			failed = append(failed, e)
+		}
+	}
+	return failed
+}
+
+// FanoutError is returned when the message could not be delivered to some endpoints of an url group.
+type FanoutError struct {
+	UrlGroup string
+	// Failed is the results of the endpoints whose message failed.
+	Failed []FanoutEndpointResult
+	// Total is the number of endpoints the message was sent to.
+	Total int
+}
+
+func (e *FanoutError) Error() string {
+	failures := make([]string, len(e.Failed))
+	for i, f := range e.Failed {
+		endpoint := f.Endpoint.Url
+		if f.Endpoint.Name != "" {
+			endpoint = fmt.Sprintf("%s (%s)", f.Endpoint.Name, f.Endpoint.Url)
+		}
+		failures[i] = fmt.Sprintf("%s: %s", endpoint, f.Error)
+	}
+	return fmt.Sprintf("delivery to %d of %d endpoints of url group %s failed: %s", len(e.Failed), e.Total, e.UrlGroup, strings.Join(failures, "; "))
+}
+
+const (
+	// fanoutLookback is how long before TrackFanout is called the events of the messages are read from, by default.
+	fanoutLookback = time.Minute
+	// defaultFanoutMaxErrors is the number of consecutive failed reads of the events TrackFanout tolerates, by default.
+	defaultFanoutMaxErrors = 5
+)
+
+type TrackFanoutOptions struct {
+	// Interval is the duration between two reads of the events, 1 second by default.
+	Interval time.Duration
+	// Since is the time the message was sent, the events before it are not read.
+	// By default, the events are read from one minute before TrackFanout is called.
+	Since time.Time
+	// MaxErrors is the number of consecutive reads of the events that can fail before TrackFanout returns the error, 5 by default.
+	// The reads that fail are retried after the interval.
+	MaxErrors int
+}
+
+// TrackFanout waits until the message sent to each endpoint of an url group is delivered or failed,
+// using the responses of Publish, PublishJSON, Enqueue or EnqueueJSON.
+// If some of the messages failed, the result is returned along with a *FanoutError.
+// If the context is done before, the result so far is returned along with the error of the context.
+// The events of the url group are listed once per interval, whatever the number of endpoints.
+func (u *UrlGroups) TrackFanout(ctx context.Context, urlGroup string, responses []PublishOrEnqueueResponse, options TrackFanoutOptions) (FanoutResult, error) {
+	if options.Interval <= 0 {
+		options.Interval = time.Second
+	}
+	if options.MaxErrors <= 0 {
+		options.MaxErrors = defaultFanoutMaxErrors
+	}
+	if options.Since.IsZero() {
+		options.Since = time.Now().Add(-fanoutLookback)
+	}
+	result := FanoutResult{UrlGroup: urlGroup, Endpoints: make([]FanoutEndpointResult, len(responses))}
+	unnamed := false
+	for i, response := range responses {
+		result.Endpoints[i] = FanoutEndpointResult{
+			Endpoint:  Endpoint{Url: response.Url, Name: response.EndpointName},
+			MessageId: response.MessageId,
+		}
+		unnamed = unnamed || response.EndpointName == ""
+	}
+	if unnamed {
+		// Older responses do not include the endpoint name, the url group may still be used to recover it.
+		if group, err := u.Get(urlGroup); err == nil {
+			names := map[string]string{}
+			for _, endpoint := range group.Endpoints {
+				names[endpoint.Url] = endpoint.Name
+			}
+			for i := range result.Endpoints {
+				if result.Endpoints[i].Endpoint.Name == "" {
+					result.Endpoints[i].Endpoint.Name = names[result.Endpoints[i].Endpoint.Url]
+				}
+			}
+		}
+	}
+
+	histories := map[string]*eventHistory{}
+	for _, endpoint := range result.Endpoints {
+		histories[endpoint.MessageId] = &eventHistory{}
+	}
+	filter := EventFilter{UrlGroup: urlGroup, FromDate: options.Since}
+	ticker := time.NewTicker(options.Interval)
+	defer ticker.Stop()
+	failures := 0
+	for {
+		latest, err := u.client.Events().listAll(ctx, filter, histories)
+		switch {
+		case err == nil:
+			failures = 0
+			// The events at the latest time are read again, in case some of them were not listed yet.
+			filter.FromDate = latest
+			for i := range result.Endpoints {
+				history := histories[result.Endpoints[i].MessageId]
+				result.Endpoints[i].State = history.latest.State
+				result.Endpoints[i].Error = history.latestError.Error
+			}
+		case ctx.Err() != nil:
+			return result, ctx.Err()
+		default:
+			if failures++; failures >= options.MaxErrors {
+				return result, fmt.Errorf("failed to read the events of url group %s: %w", urlGroup, err)
+			}
+		}
+		if result.Done() {
+			break
+		}
+		select {
+		case <-ctx.Done():
+			return result, ctx.Err()
+		case <-ticker.C:
+		}
+	}
+	if failed := result.Failed(); len(failed) > 0 {
+		return result, &FanoutError{UrlGroup: urlGroup, Failed: failed, Total: len(result.Endpoints)}
+	}
+	return result, nil
+}
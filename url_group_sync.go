@@ -0,0 +1,140 @@
+package qstash
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// UrlGroupPlan is the minimal set of changes needed to make an url group match the desired endpoints.
+type UrlGroupPlan struct {
+	// UrlGroup is the name of the url group.
+	UrlGroup string
+	// Upsert is the endpoints to add, or to update when only their name changed.
+	Upsert []Endpoint
+	// Remove is the endpoints to remove.
+	Remove []Endpoint
+	// Delete is whether the url group is deleted because no endpoints are desired.
+	Delete bool
+}
+
+// Empty reports whether the url group already matches the desired endpoints.
+func (p UrlGroupPlan) Empty() bool {
+	return len(p.Upsert) == 0 && len(p.Remove) == 0 && !p.Delete
+}
+
+// String formats the plan with one change per line.
+func (p UrlGroupPlan) String() string {
+	if p.Empty() {
+		return "no changes"
+	}
+	var b strings.Builder
+	for _, e := range p.Upsert {
+		fmt.Fprintf(&b, "%-8s %s %s\n", "upsert", e.Url, e.Name)
+	}
+	for _, e := range p.Remove {
+		fmt.Fprintf(&b, "%-8s %s %s\n", "remove", e.Url, e.Name)
+	}
+	if p.Delete {
+		fmt.Fprintf(&b, "%-8s %s\n", "delete", p.UrlGroup)
+	}
+	return b.String()
+}
+
+type SyncUrlGroupOptions struct {
+	// DryRun computes the plan without applying it.
+	DryRun bool
+	// AllowDelete allows deleting the url group when no endpoints are desired, which fails otherwise.
+	AllowDelete bool
+}
+
+// Sync makes the endpoints of an url group match the desired ones, which are identified by their url.
+// New endpoints and endpoints whose name changed are upserted before the others are removed,
+// so that the url group is never emptied, and thus deleted, while it is being updated.
+func (u *UrlGroups) Sync(ctx context.Context, urlGroup string, desired []Endpoint, options SyncUrlGroupOptions) (plan UrlGroupPlan, err error) {
+	plan.UrlGroup = urlGroup
+	wanted := map[string]bool{}
+	for _, endpoint := range desired {
+		if endpoint.Url == "" {
+			err = fmt.Errorf("`url` of the endpoint must be provided")
+			return
+		}
+		if wanted[endpoint.Url] {
+			err = fmt.Errorf("duplicate endpoint url %s", endpoint.Url)
+			return
+		}
+		wanted[endpoint.Url] = true
+	}
+	if len(desired) == 0 && !options.AllowDelete {
+		err = fmt.Errorf("no endpoints desired for url group %s, set AllowDelete to delete it", urlGroup)
+		return
+	}
+
+	var existing UrlGroup
+	response, status, err := u.client.fetchWith(requestOptions{
+		method: http.MethodGet,
+		path:   fmt.Sprintf("/v2/topics/%s", urlGroup),
+	})
+	switch {
+	case status == http.StatusNotFound:
+		err = nil
+	case err != nil:
+		return
+	default:
+		if existing, err = parse[UrlGroup](response); err != nil {
+			return
+		}
+	}
+
+	current := map[string]Endpoint{}
+	for _, endpoint := range existing.Endpoints {
+		current[endpoint.Url] = endpoint
+	}
+	for _, endpoint := range desired {
+		if e, ok := current[endpoint.Url]; !ok || e.Name != endpoint.Name {
+			plan.Upsert = append(plan.Upsert, endpoint)
+		}
+	}
+	if len(desired) == 0 {
+		plan.Delete = len(existing.Endpoints) > 0
+	} else {
+		for _, endpoint := range existing.Endpoints {
+			if !wanted[endpoint.Url] {
+				plan.Remove = append(plan.Remove, endpoint)
+			}
+		}
+	}
+	if options.DryRun {
+		return
+	}
+
+	if len(plan.Upsert) > 0 {
+		if err = ctx.Err(); err != nil {
+			return
+		}
+		if err = u.UpsertEndpoints(urlGroup, plan.Upsert); err != nil {
+			return
+		}
+	}
+	if len(plan.Remove) > 0 {
+		if err = ctx.Err(); err != nil {
+			return
+		}
+		// Only the url identifies the endpoint, its name may have been taken over by a desired endpoint.
+		removed := make([]Endpoint, len(plan.Remove))
+		for i, endpoint := range plan.Remove {
+			removed[i] = Endpoint{Url: endpoint.Url}
+		}
+		if err = u.RemoveEndpoints(urlGroup, removed); err != nil {
+			return
+		}
+	}
+	if plan.Delete {
+		if err = ctx.Err(); err != nil {
+			return
+		}
+		err = u.Delete(urlGroup)
+	}
+	return
+}
@@ -1,7 +1,11 @@
 package qstash
 
 import (
+	"context"
+	"encoding/json"
 	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
 	"testing"
 	"time"
 )
@@ -123,3 +127,137 @@ func TestEnqueueToUrlGroup(t *testing.T) {
 	assert.NotEmpty(t, res[0].MessageId)
 	assert.NotEmpty(t, res[1].MessageId)
 }
+
+func TestUrlGroupSync(t *testing.T) {
+	client := NewClientWithEnv()
+	ctx := context.Background()
+
+	name := "go_url_group_sync"
+	desired := []Endpoint{
+		{Url: "https://example.com", Name: "first"},
+		{Url: "https://example.net", Name: "second"},
+	}
+
+	plan, err := client.UrlGroups().Sync(ctx, name, desired, SyncUrlGroupOptions{DryRun: true})
+	assert.NoError(t, err)
+	assert.Equal(t, desired, plan.Upsert)
+	_, err = client.UrlGroups().Get(name)
+	assert.Error(t, err)
+
+	_, err = client.UrlGroups().Sync(ctx, name, desired, SyncUrlGroupOptions{})
+	assert.NoError(t, err)
+
+	plan, err = client.UrlGroups().Sync(ctx, name, desired, SyncUrlGroupOptions{})
+	assert.NoError(t, err)
+	assert.True(t, plan.Empty())
+
+	desired = []Endpoint{
+		{Url: "https://example.net", Name: "renamed"},
+		{Url: "https://example.org"},
+	}
+	plan, err = client.UrlGroups().Sync(ctx, name, desired, SyncUrlGroupOptions{})
+	assert.NoError(t, err)
+	assert.Equal(t, desired, plan.Upsert)
+	assert.Equal(t, []Endpoint{{Url: "https://example.com", Name: "first"}}, plan.Remove)
+
+	urlGroup, err := client.UrlGroups().Get(name)
+	assert.NoError(t, err)
+	assert.ElementsMatch(t, desired, urlGroup.Endpoints)
+
+	_, err = client.UrlGroups().Sync(ctx, name, nil, SyncUrlGroupOptions{})
+	assert.ErrorContains(t, err, "AllowDelete")
+
+	plan, err = client.UrlGroups().Sync(ctx, name, nil, SyncUrlGroupOptions{AllowDelete: true})
+	assert.NoError(t, err)
+	assert.True(t, plan.Delete)
+	_, err = client.UrlGroups().Get(name)
+	assert.Error(t, err)
+}
+
+func TestUrlGroupTrackFanout(t *testing.T) {
+	client := NewClientWithEnv()
+
+	name := "go_url_group_fanout"
+	err := client.UrlGroups().UpsertEndpoints(name, []Endpoint{
+		{Url: "https://example.com", Name: "working"},
+		{Url: "http://httpstat.us/404", Name: "missing"},
+	})
+	assert.NoError(t, err)
+
+	responses, err := client.UrlGroups().Publish(PublishUrlGroupOptions{
+		UrlGroup: name,
+		Body:     "test-body",
+		Retries:  RetryCount(0),
+	})
+	assert.NoError(t, err)
+	assert.Len(t, responses, 2)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+	result, err := client.UrlGroups().TrackFanout(ctx, name, responses, TrackFanoutOptions{Interval: 100 * time.Millisecond})
+	var fErr *FanoutError
+	assert.ErrorAs(t, err, &fErr)
+	assert.Equal(t, 2, fErr.Total)
+	assert.Len(t, fErr.Failed, 1)
+	assert.Equal(t, "missing", fErr.Failed[0].Endpoint.Name)
+	assert.True(t, result.Done())
+	for _, endpoint := range result.Endpoints {
+		if endpoint.Endpoint.Name == "working" {
+			assert.Equal(t, Delivered, endpoint.State)
+		}
+	}
+
+	err = client.UrlGroups().Delete(name)
+	assert.NoError(t, err)
+}
+
+func TestTrackFanoutReadsEvents(t *testing.T) {
+	base := time.Now().UnixMilli()
+	reads := [][]Event{
+		nil,
+		{
+			{Time: base, MessageId: "msg_1", State: Active},
+			{Time: base, MessageId: "msg_2", State: Active},
+		},
+		{
+			{Time: base + 10, MessageId: "msg_2", State: Failed, Error: "404 Not Found"},
+			{Time: base, MessageId: "msg_1", State: Delivered},
+			{Time: base, MessageId: "msg_1", State: Active},
+			{Time: base, MessageId: "msg_3", State: Failed},
+		},
+	}
+	calls := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/v2/events", r.URL.Path)
+		assert.Equal(t, "fanout", r.URL.Query().Get("topicName"))
+		assert.NotEmpty(t, r.URL.Query().Get("fromDate"))
+		calls++
+		if calls == 1 {
+			// A read that fails is retried.
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		_ = json.NewEncoder(w).Encode(listEventsResponse{Events: reads[calls-1]})
+	}))
+	defer server.Close()
+	client := NewClientWith(Options{Url: server.URL, Token: "token"})
+
+	result, err := client.UrlGroups().TrackFanout(context.Background(), "fanout", []PublishOrEnqueueResponse{
+		{MessageId: "msg_1", Url: "https://example.com", EndpointName: "working"},
+		{MessageId: "msg_2", Url: "https://example.net", EndpointName: "missing"},
+	}, TrackFanoutOptions{Interval: time.Millisecond})
+	var fErr *FanoutError
+	assert.ErrorAs(t, err, &fErr)
+	assert.Len(t, fErr.Failed, 1)
+	assert.Equal(t, "missing", fErr.Failed[0].Endpoint.Name)
+	assert.Equal(t, "404 Not Found", fErr.Failed[0].Error)
+	assert.Equal(t, Delivered, result.Endpoints[0].State)
+	assert.Equal(t, 3, calls)
+
+	// The reads are given up on after MaxErrors consecutive failures.
+	calls = 0
+	reads = [][]Event{nil, nil}
+	_, err = client.UrlGroups().TrackFanout(context.Background(), "fanout", []PublishOrEnqueueResponse{{MessageId: "msg_1", EndpointName: "working"}},
+		TrackFanoutOptions{Interval: time.Millisecond, MaxErrors: 1})
+	assert.ErrorContains(t, err, "failed to read the events of url group fanout")
+}
@@ -0,0 +1,215 @@
+package workflow
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/upstash/qstash-go"
+)
+
+// Context is the context of a run, passed to the function of a workflow.
+//
+// Its steps must be called from the goroutine of the function: once a step is executed,
+// it suspends the function with a panic that must not be recovered, see the package documentation.
+type Context interface {
+	context.Context
+	// RunId returns the id of the run.
+	RunId() string
+	// Input returns the body of the request that started the run.
+	Input() []byte
+	// Run executes fn as a step, once per run.
+	// If fn returns an error, the error is returned and the step is executed again on the next attempt.
+	// Otherwise, Run does not return: the function is suspended until the next request, which replays it.
+	Run(name string, fn func() error) error
+	// Sleep suspends the run for the given duration, which is rounded up to whole seconds.
+	Sleep(name string, duration time.Duration) error
+	// SleepUntil suspends the run until the given time.
+	SleepUntil(name string, t time.Time) error
+	// Call sends an HTTP request as a step, and returns its response.
+	// Responses are recorded whatever their status code, only the requests that fail to be sent are retried.
+	Call(name string, options CallOptions) (CallResponse, error)
+	// WaitForEvent suspends the run until the event is notified, or until the timeout.
+	// The run is registered as a waiter of the event with Options.Events.
+	WaitForEvent(name string, eventId string, timeout time.Duration) (WaitResult, error)
+
+	step(name string, typ StepType, fn func() (any, error), out any, persist func(s state) error) error
+}
+
+// WaitResult is the outcome of Context.WaitForEvent.
+type WaitResult struct {
+	// Payload is the payload the event was notified with.
+	Payload []byte `json:"payload,omitempty"`
+	// TimedOut reports whether the timeout passed before the event was notified.
+	TimedOut bool `json:"timedOut,omitempty"`
+}
+
+type CallOptions struct {
+	Url    string
+	Method string
+	Header http.Header
+	Body   []byte
+}
+
+type CallResponse struct {
+	Status int         `json:"status"`
+	Header http.Header `json:"header,omitempty"`
+	Body   []byte      `json:"body,omitempty"`
+}
+
+// Run executes fn as a step that returns a value, once per run.
+// The value is encoded as JSON, and decoded into T when the step is replayed.
+// Like Context.Run, it only returns when the step is replayed or fails, and suspends the function otherwise.
+func Run[T any](ctx Context, name string, fn func() (T, error)) (result T, err error) {
+	err = ctx.step(name, StepRun, func() (any, error) {
+		return fn()
+	}, &result, nil)
+	return
+}
+
+type runContext struct {
+	context.Context
+	options Options
+	state   state
+	// next is the index of the next step of the run.
+	next int
+	// suspended is set once a step was executed, the function must not run further steps.
+	suspended *suspended
+}
+
+func (c *runContext) RunId() string {
+	return c.state.RunId
+}
+
+func (c *runContext) Input() []byte {
+	return c.state.Input
+}
+
+func (c *runContext) Run(name string, fn func() error) error {
+	return c.step(name, StepRun, func() (any, error) {
+		return nil, fn()
+	}, nil, nil)
+}
+
+func (c *runContext) Sleep(name string, duration time.Duration) error {
+	return c.step(name, StepSleep, nil, nil, c.publish(qstash.PublishOptions{Delay: qstash.FormatDelay(duration)}))
+}
+
+func (c *runContext) SleepUntil(name string, t time.Time) error {
+	return c.step(name, StepSleep, nil, nil, c.publish(qstash.PublishOptions{NotBefore: qstash.FormatNotBefore(t)}))
+}
+
+func (c *runContext) Call(name string, options CallOptions) (response CallResponse, err error) {
+	err = c.step(name, StepCall, func() (any, error) {
+		return c.call(options)
+	}, &response, nil)
+	return
+}
+
+func (c *runContext) WaitForEvent(name string, eventId string, timeout time.Duration) (result WaitResult, err error) {
+	if c.options.Events == nil {
+		return result, fmt.Errorf("waiting for events requires Options.Events")
+	}
+	err = c.step(name, StepWait, nil, &result, func(s state) error {
+		// The run continues with the result as the output of the wait step.
+		resume := func(result WaitResult) (qstash.PublishOptions, error) {
+			output, err := json.Marshal(result)
+			if err != nil {
+				return qstash.PublishOptions{}, err
+			}
+			s.Steps = append(s.Steps[:len(s.Steps)-1:len(s.Steps)-1], Step{Name: name, Type: StepWait, Output: output})
+			return stateMessage(c.options.Url, s, qstash.PublishOptions{Retries: c.options.Retries})
+		}
+		timedOut, err := resume(WaitResult{TimedOut: true})
+		if err != nil {
+			return err
+		}
+		return c.options.Events.Wait(eventId, timeout, func(payload []byte) qstash.PublishOptions {
+			// The state only holds bytes and strings, encoding it can not fail.
+			notified, _ := resume(WaitResult{Payload: payload})
+			return notified
+		}, timedOut)
+	})
+	return
+}
+
+// publish returns a function that publishes the state of the run to the workflow with the options.
+func (c *runContext) publish(options qstash.PublishOptions) func(s state) error {
+	return func(s state) error {
+		options.Retries = c.options.Retries
+		return publish(c.options.Client, c.options.Url, s, options)
+	}
+}
+
+func (c *runContext) call(options CallOptions) (response CallResponse, err error) {
+	method := options.Method
+	if method == "" {
+		method = http.MethodPost
+	}
+	request, err := http.NewRequestWithContext(c, method, options.Url, bytes.NewReader(options.Body))
+	if err != nil {
+		return
+	}
+	request.Header = options.Header.Clone()
+	if request.Header == nil {
+		request.Header = http.Header{}
+	}
+	res, err := c.options.HTTPClient.Do(request)
+	if err != nil {
+		return
+	}
+	defer res.Body.Close()
+	body, err := io.ReadAll(res.Body)
+	if err != nil {
+		return
+	}
+	return CallResponse{Status: res.StatusCode, Header: res.Header, Body: body}, nil
+}
+
+// step replays the next step of the run if it was recorded, decoding its output into out.
+// Otherwise, it executes fn, records its output and persists the new state of the run, publishing it by default,
+// then suspends the function until the next request.
+func (c *runContext) step(name string, typ StepType, fn func() (any, error), out any, persist func(s state) error) error {
+	if c.suspended != nil {
+		panic(*c.suspended)
+	}
+	if c.next < len(c.state.Steps) {
+		recorded := c.state.Steps[c.next]
+		if recorded.Name != name || recorded.Type != typ {
+			return fmt.Errorf("%w: step %d is %s %q, but it was recorded as %s %q",
+				ErrNonDeterministic, c.next, typ, name, recorded.Type, recorded.Name)
+		}
+		c.next++
+		if out == nil || len(recorded.Output) == 0 {
+			return nil
+		}
+		return json.Unmarshal(recorded.Output, out)
+	}
+	executed := Step{Name: name, Type: typ}
+	if fn != nil {
+		output, err := fn()
+		if err != nil {
+			return err
+		}
+		if output != nil {
+			if executed.Output, err = json.Marshal(output); err != nil {
+				return err
+			}
+		}
+	}
+	s := c.state
+	s.Steps = append(s.Steps[:len(s.Steps):len(s.Steps)], executed)
+	if persist == nil {
+		persist = c.publish(qstash.PublishOptions{})
+	}
+	err := persist(s)
+	if err != nil {
+		err = fmt.Errorf("failed to persist step %q: %w", name, err)
+	}
+	c.suspended = &suspended{err: err}
+	panic(*c.suspended)
+}
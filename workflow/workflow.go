@@ -0,0 +1,217 @@
+// Package workflow runs durable functions on top of QStash.
+//
+// A workflow is a function served at a public url, whose steps are executed one request at a time.
+// After each step, the result of the step is published back to the same url through QStash, along with
+// the results of the previous steps. So every request replays the function from the start, skips the steps
+// that already ran by returning their recorded result, and executes the next one.
+// Since QStash retries failed deliveries, a run survives crashes and deployments, and a failed step
+// is retried without running the previous steps again.
+//
+// Because of the replays, the code of a workflow outside of its steps must be deterministic:
+// it must call the same steps in the same order on every request.
+//
+// Once a step is executed and its result published, the function is suspended by a panic that Serve recovers.
+// So steps must be called from the goroutine of the function, and not from code that recovers panics without re-panicking them.
+package workflow
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/upstash/qstash-go"
+)
+
+const (
+	runIdHeader        = "Upstash-Workflow-RunId"
+	nonRetryableHeader = "Upstash-NonRetryable-Error"
+)
+
+var (
+	ErrNonDeterministic = fmt.Errorf("workflow is not deterministic")
+)
+
+// Func is the function of a workflow.
+// It returns nil when the run is finished, and an error to fail the current request, which QStash retries.
+type Func func(ctx Context) error
+
+type Options struct {
+	// Client publishes the steps of the runs.
+	Client *qstash.Client
+	// Url is the public address the workflow is served at, which the steps are published to.
+	Url string
+	// Receiver verifies the signature of the requests, when it is set.
+	Receiver *qstash.Receiver
+	// Retries is the number of times QStash retries a step, the default of QStash is used when it is nil.
+	Retries *int
+	// HTTPClient sends the requests of Context.Call, http.DefaultClient by default.
+	HTTPClient *http.Client
+	// Events registers the runs that wait for an event with Context.WaitForEvent, which fails when it is not set.
+	// QStash does not support waiting for events yet, dev.Server implements it for local development and tests.
+	Events EventWaiter
+}
+
+// EventWaiter registers waiters for events, and publishes a message to each of them when their event is notified.
+type EventWaiter interface {
+	// Wait registers a waiter for an event. When the event is notified, the message returned by notified
+	// for the payload of the event is published, and timedOut is published instead if the timeout passes first.
+	Wait(eventId string, timeout time.Duration, notified func(payload []byte) qstash.PublishOptions, timedOut qstash.PublishOptions) error
+}
+
+// state is the body of the requests that continue a run.
+type state struct {
+	RunId string `json:"runId"`
+	Input []byte `json:"input"`
+	Steps []Step `json:"steps"`
+}
+
+type StepType string
+
+var (
+	StepRun   StepType = "run"
+	StepSleep StepType = "sleep"
+	StepCall  StepType = "call"
+	StepWait  StepType = "wait"
+)
+
+// Step is the recorded result of a step of a run.
+type Step struct {
+	Name   string          `json:"name"`
+	Type   StepType        `json:"type"`
+	Output json.RawMessage `json:"output,omitempty"`
+}
+
+// Serve returns the HTTP handler of a workflow.
+//
+// A request without a run id starts a new run, with the body of the request as the input of the run.
+// Runs can also be started with Trigger.
+func Serve(fn Func, options Options) http.Handler {
+	if options.HTTPClient == nil {
+		options.HTTPClient = http.DefaultClient
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, err := io.ReadAll(r.Body)
+		if err != nil {
+			http.Error(w, "failed to read body", http.StatusBadRequest)
+			return
+		}
+		if options.Receiver != nil {
+			err = options.Receiver.Verify(qstash.VerifyOptions{
+				Signature: r.Header.Get("Upstash-Signature"),
+				Body:      string(body),
+				Url:       options.Url,
+			})
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusUnauthorized)
+				return
+			}
+		}
+		s := state{RunId: r.Header.Get(runIdHeader)}
+		if s.RunId == "" {
+			s.RunId = newRunId()
+			s.Input = body
+		} else if err = json.Unmarshal(body, &s); err != nil {
+			w.Header().Set(nonRetryableHeader, "true")
+			http.Error(w, fmt.Sprintf("invalid workflow state: %v", err), qstash.StatusNonRetryable)
+			return
+		}
+		c := &runContext{
+			Context: r.Context(),
+			options: options,
+			state:   s,
+		}
+		if err = execute(fn, c); err != nil {
+			// A run that does not replay its recorded steps would fail the same way on every retry.
+			if errors.Is(err, qstash.ErrDoNotRetry) || errors.Is(err, ErrNonDeterministic) {
+				w.Header().Set(nonRetryableHeader, "true")
+				http.Error(w, err.Error(), qstash.StatusNonRetryable)
+				return
+			}
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	})
+}
+
+// suspended is the panic that stops the function once a step was executed and published.
+type suspended struct {
+	err error
+}
+
+// execute runs the function until it returns, or until a step suspends it.
+// The function is also considered suspended if it recovered the panic of a step and returned.
+func execute(fn Func, c *runContext) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			s, ok := r.(suspended)
+			if !ok {
+				panic(r)
+			}
+			err = s.err
+		}
+	}()
+	err = fn(c)
+	if c.suspended != nil {
+		return c.suspended.err
+	}
+	return err
+}
+
+type TriggerOptions struct {
+	// Url is the public address of the workflow.
+	Url string
+	// Body is the input of the run.
+	Body []byte
+	// Retries is the number of times QStash retries the first step, the default of QStash is used when it is nil.
+	Retries *int
+	// Delay delays the start of the run.
+	Delay string
+}
+
+// Trigger starts a new run of the workflow served at the url, and returns the id of the run.
+func Trigger(client *qstash.Client, options TriggerOptions) (runId string, err error) {
+	runId = newRunId()
+	err = publish(client, options.Url, state{RunId: runId, Input: options.Body}, qstash.PublishOptions{
+		Retries: options.Retries,
+		Delay:   options.Delay,
+	})
+	return
+}
+
+// publish publishes the state of a run to the workflow.
+func publish(client *qstash.Client, url string, s state, options qstash.PublishOptions) error {
+	options, err := stateMessage(url, s, options)
+	if err != nil {
+		return err
+	}
+	_, err = client.Publish(options)
+	return err
+}
+
+// stateMessage returns the message that continues a run with the state.
+// It is deduplicated by the run id and the number of recorded steps, so that a step persisted again
+// by a retried request, or a waiter resumed twice, does not continue the run twice.
+func stateMessage(url string, s state, options qstash.PublishOptions) (qstash.PublishOptions, error) {
+	body, err := json.Marshal(s)
+	if err != nil {
+		return options, err
+	}
+	options.Url = url
+	options.DeduplicationId = fmt.Sprintf("%s-%d", s.RunId, len(s.Steps))
+	options.Body = string(body)
+	options.ContentType = "application/json"
+	options.Headers = map[string]string{runIdHeader: s.RunId}
+	return options, nil
+}
+
+func newRunId() string {
+	b := make([]byte, 12)
+	_, _ = rand.Read(b)
+	return "wfr_" + hex.EncodeToString(b)
+}
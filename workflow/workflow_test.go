@@ -0,0 +1,268 @@
+package workflow
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/upstash/qstash-go"
+	"github.com/upstash/qstash-go/dev"
+)
+
+func startServer(t *testing.T) *dev.Server {
+	server := dev.New(dev.Options{
+		RetryBackoff: func(int) time.Duration { return 10 * time.Millisecond },
+	})
+	assert.NoError(t, server.Start())
+	t.Cleanup(func() {
+		_ = server.Close()
+	})
+	return server
+}
+
+func TestWorkflow(t *testing.T) {
+	server := startServer(t)
+	api := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusAccepted)
+		_, _ = w.Write([]byte("charged " + r.URL.Query().Get("amount")))
+	}))
+	defer api.Close()
+
+	var mu sync.Mutex
+	executions := map[string]int{}
+	execute := func(name string) int {
+		mu.Lock()
+		defer mu.Unlock()
+		executions[name]++
+		return executions[name]
+	}
+	type result struct {
+		runId  string
+		amount int
+		call   CallResponse
+		slept  time.Duration
+	}
+	done := make(chan result, 1)
+
+	target := httptest.NewServer(nil)
+	defer target.Close()
+	retries := 3
+	target.Config.Handler = Serve(func(ctx Context) error {
+		amount, err := Run(ctx, "parse", func() (int, error) {
+			execute("parse")
+			var input struct {
+				Amount int `json:"amount"`
+			}
+			err := json.Unmarshal(ctx.Input(), &input)
+			return input.Amount * 2, err
+		})
+		if err != nil {
+			return err
+		}
+		start, err := Run(ctx, "start", func() (time.Time, error) {
+			return time.Now(), nil
+		})
+		if err != nil {
+			return err
+		}
+		err = ctx.Run("flaky", func() error {
+			if execute("flaky") == 1 {
+				return fmt.Errorf("not yet")
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		if err = ctx.Sleep("wait", time.Second); err != nil {
+			return err
+		}
+		call, err := ctx.Call("charge", CallOptions{Url: fmt.Sprintf("%s?amount=%d", api.URL, amount)})
+		if err != nil {
+			return err
+		}
+		return ctx.Run("finish", func() error {
+			execute("finish")
+			done <- result{runId: ctx.RunId(), amount: amount, call: call, slept: time.Since(start)}
+			return nil
+		})
+	}, Options{
+		Client:   server.Client(),
+		Url:      target.URL,
+		Receiver: server.Receiver(),
+		Retries:  &retries,
+	})
+
+	runId, err := Trigger(server.Client(), TriggerOptions{Url: target.URL, Body: []byte(`{"amount": 21}`)})
+	assert.NoError(t, err)
+
+	select {
+	case r := <-done:
+		assert.Equal(t, runId, r.runId)
+		assert.Equal(t, 42, r.amount)
+		assert.Equal(t, http.StatusAccepted, r.call.Status)
+		assert.Equal(t, "charged 42", string(r.call.Body))
+		assert.GreaterOrEqual(t, r.slept, time.Second)
+	case <-time.After(10 * time.Second):
+		t.Fatal("workflow did not finish")
+	}
+	time.Sleep(50 * time.Millisecond)
+	mu.Lock()
+	defer mu.Unlock()
+	assert.Equal(t, map[string]int{"parse": 1, "flaky": 2, "finish": 1}, executions)
+}
+
+func TestWorkflowNonDeterministic(t *testing.T) {
+	handler := Serve(func(ctx Context) error {
+		return ctx.Run("second", func() error { return nil })
+	}, Options{})
+
+	body, err := json.Marshal(state{RunId: "wfr_1", Steps: []Step{{Name: "first", Type: StepRun}}})
+	assert.NoError(t, err)
+	r := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(string(body)))
+	r.Header.Set("Upstash-Workflow-RunId", "wfr_1")
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, r)
+	assert.Equal(t, qstash.StatusNonRetryable, w.Code)
+	assert.Equal(t, "true", w.Header().Get("Upstash-NonRetryable-Error"))
+	assert.Contains(t, w.Body.String(), ErrNonDeterministic.Error())
+
+	r = httptest.NewRequest(http.MethodPost, "/", strings.NewReader("not json"))
+	r.Header.Set("Upstash-Workflow-RunId", "wfr_1")
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, r)
+	assert.Equal(t, qstash.StatusNonRetryable, w.Code)
+}
+
+func TestWorkflowRecoveredSuspension(t *testing.T) {
+	persisted := 0
+	persist := func(s state) error {
+		persisted++
+		return nil
+	}
+	c := &runContext{Context: context.Background(), state: state{RunId: "wfr_1"}}
+	err := execute(func(ctx Context) error {
+		func() {
+			defer func() { _ = recover() }()
+			_ = ctx.step("first", StepRun, nil, nil, persist)
+		}()
+		_ = ctx.step("second", StepRun, nil, nil, persist)
+		return fmt.Errorf("unreachable")
+	}, c)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, persisted)
+
+	c = &runContext{Context: context.Background(), state: state{RunId: "wfr_1"}}
+	err = execute(func(ctx Context) error {
+		defer func() { _ = recover() }()
+		return ctx.step("first", StepRun, nil, nil, persist)
+	}, c)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, persisted)
+}
+
+func TestWorkflowDeduplication(t *testing.T) {
+	server := startServer(t)
+	var mu sync.Mutex
+	var received []string
+	target := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		mu.Lock()
+		defer mu.Unlock()
+		received = append(received, string(body))
+	}))
+	defer target.Close()
+
+	// A step persisted again by a retried request continues the run once.
+	for i := 0; i < 2; i++ {
+		c := &runContext{
+			Context: context.Background(),
+			options: Options{Client: server.Client(), Url: target.URL},
+			state:   state{RunId: "wfr_1"},
+		}
+		err := execute(func(ctx Context) error {
+			return ctx.Run("first", func() error { return nil })
+		}, c)
+		assert.NoError(t, err)
+	}
+	assert.Eventually(t, func() bool {
+		mu.Lock()
+		defer mu.Unlock()
+		return len(received) == 1
+	}, 5*time.Second, 10*time.Millisecond)
+	time.Sleep(100 * time.Millisecond)
+	mu.Lock()
+	assert.Len(t, received, 1)
+	assert.Contains(t, received[0], `"name":"first"`)
+	mu.Unlock()
+
+	// Triggering a run is deduplicated by its run id.
+	options, err := stateMessage(target.URL, state{RunId: "wfr_2"}, qstash.PublishOptions{})
+	assert.NoError(t, err)
+	assert.Equal(t, "wfr_2-0", options.DeduplicationId)
+}
+
+func TestWorkflowWaitForEvent(t *testing.T) {
+	server := startServer(t)
+	client := server.Client()
+
+	results := make(chan WaitResult, 2)
+	target := httptest.NewServer(nil)
+	defer target.Close()
+	target.Config.Handler = Serve(func(ctx Context) error {
+		timeout, err := Run(ctx, "timeout", func() (time.Duration, error) {
+			var input struct {
+				Timeout time.Duration `json:"timeout"`
+			}
+			err := json.Unmarshal(ctx.Input(), &input)
+			return input.Timeout, err
+		})
+		if err != nil {
+			return err
+		}
+		result, err := ctx.WaitForEvent("approval", "approval-"+ctx.RunId(), timeout)
+		if err != nil {
+			return err
+		}
+		return ctx.Run("report", func() error {
+			results <- result
+			return nil
+		})
+	}, Options{
+		Client:   client,
+		Url:      target.URL,
+		Receiver: server.Receiver(),
+		Events:   server,
+	})
+
+	runId, err := Trigger(client, TriggerOptions{Url: target.URL, Body: []byte(`{"timeout": 60000000000}`)})
+	assert.NoError(t, err)
+	assert.Eventually(t, func() bool {
+		notified, err := server.Notify("approval-"+runId, []byte("approved"))
+		assert.NoError(t, err)
+		return len(notified) == 1
+	}, 5*time.Second, 20*time.Millisecond)
+	select {
+	case result := <-results:
+		assert.Equal(t, WaitResult{Payload: []byte("approved")}, result)
+	case <-time.After(5 * time.Second):
+		t.Fatal("workflow was not notified")
+	}
+
+	_, err = Trigger(client, TriggerOptions{Url: target.URL, Body: []byte(`{"timeout": 1000000000}`)})
+	assert.NoError(t, err)
+	select {
+	case result := <-results:
+		assert.True(t, result.TimedOut)
+	case <-time.After(5 * time.Second):
+		t.Fatal("wait did not time out")
+	}
+}